@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ishowdarkside/go-movies-app/internal/data"
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+)
+
+// deleteCurrentUserHandler schedules the account for deletion after the
+// user re-enters their password, and a second factor if they use one. The
+// account can be restored with the emailed token until the grace period
+// ends.
+func (app *application) deleteCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	if user.ServiceAccount {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Password != "", "password", "must be provided")
+
+	if user.TwoFactorEnabled {
+		data.ValidateTwoFactorCode(v, input.Code)
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !match {
+		v.AddError("password", "is incorrect")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if user.TwoFactorEnabled {
+
+		ok, err := app.verifySecondFactor(user.ID, input.Code)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if !ok {
+			v.AddError("code", "is invalid or has already been used")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	err = app.models.Users.SoftDelete(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.ID, app.config.accounts.deletionGracePeriod, data.ScopeAccountRestore)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.background(func() {
+
+		data := map[string]any{
+			"restoreToken": token.PlainText,
+			"deletionDate": token.Expiry.Format("2 January 2006"),
+		}
+
+		err := app.mailer.Send(user.Email, "account_deleted.tmpl", data)
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+	})
+
+	env := envelope{
+		"message":          "your account has been scheduled for deletion, an email will be sent containing instructions to restore it",
+		"restorable_until": token.Expiry.Truncate(time.Second),
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) restoreUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlainText(v, input.Token); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopeAccountRestore, input.Token)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddError("token", "invalid or expired restore token")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.models.Users.Restore(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeAccountRestore, user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your account was successfully restored, please sign in again"}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ishowdarkside/go-movies-app/internal/data"
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+)
+
+func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		Search    string
+		Activated *bool
+		data.Filters
+	}
+
+	queryString := r.URL.Query()
+	v := validator.New()
+
+	input.Search = app.readString(queryString, "search", "")
+
+	if s := app.readString(queryString, "activated", ""); s != "" {
+
+		activated, err := strconv.ParseBool(s)
+		if err != nil {
+			v.AddError("activated", "must be a boolean value")
+		}
+		input.Activated = &activated
+	}
+
+	input.Page = app.readInt(queryString, "page", 1, v)
+	input.PageSize = app.readInt(queryString, "page_size", 20, v)
+	input.Sort = app.readString(queryString, "sort_by", "id")
+	input.SortSafelist = []string{"id", "name", "email", "created_at", "-id", "-name", "-email", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	users, metadata, err := app.models.Users.GetAll(input.Search, input.Activated, input.Filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"metadata": metadata, "users": users}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) showUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	roles, err := app.models.Roles.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user, "roles": roles, "permissions": permissions}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+// updateUserActivationHandler deactivates or reactivates an account.
+// Deactivating also signs the user out everywhere; signed access tokens
+// can't be revoked, but they can't be refreshed either.
+func (app *application) updateUserActivationHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Activated *bool `json:"activated"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Activated != nil, "activated", "must be provided")
+
+	if input.Activated != nil && !*input.Activated {
+		v.Check(user.ID != app.contextGetUser(r).ID, "activated", "you cannot deactivate your own account")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Deactivation is kept apart from activation so the user can't undo it
+	// by requesting a new activation token.
+	user.Deactivated = !*input.Activated
+
+	if *input.Activated {
+		user.Activated = true
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+
+		if errors.Is(err, data.ErrEditConflict) {
+			app.editConflictResponse(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	if user.Deactivated {
+
+		err = app.models.Tokens.DeleteSessionsForUser(user.ID, "")
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+// forcePasswordResetHandler replaces the user's password with one nobody
+// knows, signs them out everywhere and emails them a password reset token.
+func (app *application) forcePasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	if user.ServiceAccount {
+		app.notFoundError(w, r)
+		return
+	}
+
+	err := user.Password.Set(rand.Text() + rand.Text())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+
+		if errors.Is(err, data.ErrEditConflict) {
+			app.editConflictResponse(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.models.Tokens.DeleteSessionsForUser(user.ID, "")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopePasswordReset)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.background(func() {
+
+		data := map[string]any{
+			"passwordResetToken": token.PlainText,
+		}
+
+		err := app.mailer.Send(user.Email, "password_reset_required.tmpl", data)
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": "the user's password has been reset and an email will be sent containing instructions to choose a new one"}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) grantUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	known, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	granterPermissions, err := app.permissionsForRequest(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidatePermissionCodes(v, input.Permissions, known, granterPermissions); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Permissions.AddForUser(user.ID, input.Permissions...)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"permissions": permissions}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) revokeUserPermissionHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Permissions.RemoveForUser(user.ID, app.readStringParam(r, "code"))
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundError(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "permission successfully revoked"}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+// readUser loads the user named by the :id parameter, writing an error
+// response and returning false if it can't.
+func (app *application) readUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundError(w, r)
+		return nil, false
+	}
+
+	user, err := app.models.Users.Get(id)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundError(w, r)
+			return nil, false
+		}
+
+		app.serverError(w, r, err)
+		return nil, false
+	}
+
+	return user, true
+
+}
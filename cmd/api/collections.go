@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ishowdarkside/go-movies-app/internal/data"
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+)
+
+func (app *application) createCollectionHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	collection := &data.Collection{
+		Name:        input.Name,
+		Description: input.Description,
+	}
+
+	v := validator.New()
+
+	if data.ValidateCollection(v, collection); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Collections.Insert(collection)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/collections/%d", collection.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"collection": collection}, headers)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) showCollectionHandler(w http.ResponseWriter, r *http.Request) {
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundError(w, r)
+		return
+	}
+
+	v := validator.New()
+	runtimeFormat := app.readRuntimeFormat(w, r, v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	collection, err := app.models.Collections.Get(id)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundError(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	collection.Movies, err = app.models.Collections.GetMovies(collection.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	for _, movie := range collection.Movies {
+		movie.RuntimeFormat = runtimeFormat
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"collection": collection}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) updateCollectionHandler(w http.ResponseWriter, r *http.Request) {
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundError(w, r)
+		return
+	}
+
+	collection, err := app.models.Collections.Get(id)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundError(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	if r.Header.Get("X-Expected-Version") != "" {
+
+		if strconv.Itoa(int(collection.Version)) != r.Header.Get("X-Expected-Version") {
+			app.editConflictResponse(w, r)
+			return
+		}
+	}
+
+	var input struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		collection.Name = *input.Name
+	}
+
+	if input.Description != nil {
+		collection.Description = *input.Description
+	}
+
+	v := validator.New()
+
+	if data.ValidateCollection(v, collection); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Collections.Update(collection)
+	if err != nil {
+
+		if errors.Is(err, data.ErrEditConflict) {
+			app.editConflictResponse(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"collection": collection}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) updateCollectionMoviesHandler(w http.ResponseWriter, r *http.Request) {
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundError(w, r)
+		return
+	}
+
+	var input struct {
+		Movies []int64 `json:"movies"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	runtimeFormat := app.readRuntimeFormat(w, r, v)
+
+	if data.ValidateCollectionMovies(v, input.Movies); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	collection, err := app.models.Collections.Get(id)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundError(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.models.Collections.SetMovies(collection, input.Movies)
+	if err != nil {
+
+		switch {
+		case errors.Is(err, data.ErrUnknownMovie):
+			v.AddError("movies", "must only contain existing movies")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	collection.Movies, err = app.models.Collections.GetMovies(collection.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	for _, movie := range collection.Movies {
+		movie.RuntimeFormat = runtimeFormat
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"collection": collection}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundError(w, r)
+		return
+	}
+
+	err = app.models.Collections.Delete(id)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundError(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "collection successfully deleted"}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) listCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		Name string
+		data.Filters
+	}
+
+	queryString := r.URL.Query()
+	v := validator.New()
+
+	input.Name = app.readString(queryString, "name", "")
+	input.Page = app.readInt(queryString, "page", 1, v)
+	input.PageSize = app.readInt(queryString, "page_size", 20, v)
+	input.Sort = app.readString(queryString, "sort_by", "id")
+	input.SortSafelist = []string{"id", "name", "-id", "-name"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	collections, metadata, err := app.models.Collections.GetAll(input.Name, input.Filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"metadata": metadata, "collections": collections}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
@@ -10,6 +10,18 @@ import (
 type contextKey string
 
 const userContextKy = contextKey("user")
+const sessionContextKey = contextKey("session")
+const permissionsContextKey = contextKey("permissions")
+const credentialContextKey = contextKey("credential")
+
+// Kinds of credential a request can be authenticated with. API keys and
+// OAuth access tokens act on a user's behalf with limited permissions, so
+// they can't manage the account itself.
+const (
+	credentialSession = "session"
+	credentialAPIKey  = "api_key"
+	credentialOAuth   = "oauth"
+)
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
 
@@ -29,3 +41,52 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	return user
 
 }
+
+func (app *application) contextSetSession(r *http.Request, sessionID string) *http.Request {
+
+	ctx := context.WithValue(r.Context(), sessionContextKey, sessionID)
+	return r.WithContext(ctx)
+
+}
+
+// contextGetSession returns the ID of the session the request was
+// authenticated with, or an empty string for anonymous requests.
+func (app *application) contextGetSession(r *http.Request) string {
+
+	sessionID, _ := r.Context().Value(sessionContextKey).(string)
+	return sessionID
+
+}
+
+// contextSetPermissions pins the permissions for the request when the
+// credential carries its own, such as an API key or OAuth access token,
+// instead of inheriting everything the user holds.
+func (app *application) contextSetPermissions(r *http.Request, permissions data.Permissions) *http.Request {
+
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+	return r.WithContext(ctx)
+
+}
+
+func (app *application) contextSetCredential(r *http.Request, kind string) *http.Request {
+
+	ctx := context.WithValue(r.Context(), credentialContextKey, kind)
+	return r.WithContext(ctx)
+
+}
+
+// contextGetCredential returns the kind of credential the request was
+// authenticated with, or an empty string for anonymous requests.
+func (app *application) contextGetCredential(r *http.Request) string {
+
+	kind, _ := r.Context().Value(credentialContextKey).(string)
+	return kind
+
+}
+
+func (app *application) contextGetPermissions(r *http.Request) (data.Permissions, bool) {
+
+	permissions, ok := r.Context().Value(permissionsContextKey).(data.Permissions)
+	return permissions, ok
+
+}
@@ -3,7 +3,10 @@ package main
 import (
 	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func (app *application) logError(r *http.Request, err error) {
@@ -83,6 +86,11 @@ func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http
 	app.errorResponse(w, r, http.StatusTooManyRequests, "rate limit exceeded")
 }
 
+func (app *application) loginThrottledResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	app.errorResponse(w, r, http.StatusTooManyRequests, "too many failed sign-in attempts, please try again later")
+}
+
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 
 	message := "invalid authentication credentials"
@@ -98,6 +106,60 @@ func (app *application) invalidAuthenicationTokenResponse(w http.ResponseWriter,
 
 }
 
+func (app *application) invalidAPIKeyResponse(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("WWW-Authenticate", "ApiKey")
+
+	message := "invalid, expired or revoked API key"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+
+}
+
+// oauthErrorResponse writes an error in the RFC 6749 format expected by
+// OAuth client libraries.
+func (app *application) oauthErrorResponse(w http.ResponseWriter, r *http.Request, status int, code, description string) {
+
+	env := envelope{"error": code, "error_description": description}
+
+	err := app.writeJSON(w, status, env, oauthNoStoreHeaders())
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+}
+
+func (app *application) invalidOAuthClientResponse(w http.ResponseWriter, r *http.Request, basic bool) {
+
+	if basic {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+
+	app.oauthErrorResponse(w, r, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+
+}
+
+func (app *application) twoFactorRequiredResponse(w http.ResponseWriter, r *http.Request) {
+
+	message := "your user account must have two-factor authentication enabled to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+
+}
+
+func (app *application) twoFactorEnabledResponse(w http.ResponseWriter, r *http.Request) {
+
+	message := "two-factor authentication is already enabled for your account"
+	app.errorResponse(w, r, http.StatusConflict, message)
+
+}
+
+func (app *application) invalidRefreshTokenResponse(w http.ResponseWriter, r *http.Request) {
+
+	message := "invalid or expired refresh token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+
+}
+
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
 
 	message := `you must be authenticated to access this resource`
@@ -112,6 +174,20 @@ func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.R
 
 }
 
+func (app *application) accountDeactivatedResponse(w http.ResponseWriter, r *http.Request) {
+
+	message := "your user account has been deactivated, please contact an administrator"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+
+}
+
+func (app *application) sessionRequiredResponse(w http.ResponseWriter, r *http.Request) {
+
+	message := "this resource can only be accessed by signing in, not with an API key or OAuth access token"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+
+}
+
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
 
 	msg := `your account doesn't have the necessary permissions to access this resource`
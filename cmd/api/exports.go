@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ishowdarkside/go-movies-app/internal/data"
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+)
+
+// exportCurrentUserHandler starts building an archive of the user's personal
+// data. It can take a while, so the download token is emailed once ready.
+func (app *application) exportCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := app.contextGetUser(r)
+
+	if user.ServiceAccount {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	if !app.emailThrottle.Allow("export:" + strconv.FormatInt(user.ID, 10)) {
+		app.rateLimitExceededResponse(w, r)
+		return
+	}
+
+	app.background(func() {
+
+		export, err := app.models.DataExports.New(user.ID, app.config.accounts.exportTTL)
+		if err != nil {
+			app.logger.Error(err.Error())
+			return
+		}
+
+		data := map[string]any{
+			"exportToken": export.PlainText,
+			"expiry":      export.Expiry.Format("2 January 2006 15:04 MST"),
+		}
+
+		err = app.mailer.Send(user.Email, "data_export.tmpl", data)
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+	})
+
+	err := app.writeJSON(w, http.StatusAccepted, envelope{"message": "your data export is being prepared, an email will be sent containing a download link"}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) downloadExportHandler(w http.ResponseWriter, r *http.Request) {
+
+	token := app.readStringParam(r, "token")
+
+	v := validator.New()
+
+	if data.ValidateTokenPlainText(v, token); !v.Valid() {
+		app.notFoundError(w, r)
+		return
+	}
+
+	archive, err := app.models.DataExports.GetArchiveForToken(token)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundError(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="moviesapi-export.json"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+
+}
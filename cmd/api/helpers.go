@@ -5,11 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 
+	"github.com/ishowdarkside/go-movies-app/internal/data"
 	"github.com/ishowdarkside/go-movies-app/internal/validator"
 	"github.com/julienschmidt/httprouter"
 )
@@ -18,18 +20,37 @@ type envelope map[string]any
 
 func (app *application) readIDParam(r *http.Request) (int64, error) {
 
+	return app.readNamedIDParam(r, "id")
+
+}
+
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
+
 	params := httprouter.ParamsFromContext(r.Context())
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 
 	if err != nil || id < 1 {
 
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	return id, nil
 
 }
 
+func (app *application) readStringParam(r *http.Request, name string) string {
+
+	params := httprouter.ParamsFromContext(r.Context())
+	return params.ByName(name)
+
+}
+
+func (app *application) readTagParam(r *http.Request) string {
+
+	return data.NormalizeTag(app.readStringParam(r, "tag"))
+
+}
+
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
 
 	js, err := json.Marshal(data)
@@ -145,6 +166,39 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 
 }
 
+// readRuntimeFormat picks the runtime output format from the runtime_format
+// query parameter, falling back to an Accept profile such as
+// `application/json; profile="runtime-iso8601"`.
+func (app *application) readRuntimeFormat(w http.ResponseWriter, r *http.Request, v *validator.Validator) data.RuntimeFormat {
+
+	w.Header().Add("Vary", "Accept")
+
+	format := data.RuntimeFormat(r.URL.Query().Get("runtime_format"))
+	if format != "" {
+		v.Check(validator.PermittedValue(format, data.RuntimeFormats...), "runtime_format", "must be one of minutes, mins, iso8601 or human")
+		return format
+	}
+
+	for mediaRange := range strings.SplitSeq(r.Header.Get("Accept"), ",") {
+
+		_, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+
+		for profile := range strings.FieldsSeq(params["profile"]) {
+
+			format := data.RuntimeFormat(strings.TrimPrefix(profile, "runtime-"))
+			if strings.HasPrefix(profile, "runtime-") && validator.PermittedValue(format, data.RuntimeFormats...) {
+				return format
+			}
+		}
+	}
+
+	return data.RuntimeFormatMins
+
+}
+
 func (app *application) background(fn func()) {
 
 	app.wg.Add(1)
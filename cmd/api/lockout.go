@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ishowdarkside/go-movies-app/internal/data"
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+	"github.com/tomasen/realip"
+)
+
+// recordAuthEvent writes to the audit trail of sign-in activity. Failing to
+// record an event is logged but never fails the request.
+func (app *application) recordAuthEvent(r *http.Request, event string, email string, user *data.User) {
+
+	e := &data.AuthEvent{
+		Event:     event,
+		Email:     email,
+		IP:        realip.FromRequest(r),
+		UserAgent: r.UserAgent(),
+	}
+
+	if user != nil {
+		e.UserID = &user.ID
+	}
+
+	err := app.models.AuthEvents.Insert(e)
+	if err != nil {
+		app.logError(r, err)
+	}
+
+}
+
+// loginRetryAfter returns how long sign-in attempts for email from the
+// request's IP address have to wait. Unknown addresses are throttled in
+// exactly the same way as real ones.
+func (app *application) loginRetryAfter(r *http.Request, email string) (time.Duration, error) {
+
+	return app.models.LoginThrottle.RetryAfter(data.LoginThrottleEmailKey(email), data.LoginThrottleIPKey(realip.FromRequest(r)))
+
+}
+
+// recordLoginFailure counts a failed sign-in against both the address and
+// the IP address. When that locks the account, its owner is sent a
+// notification with a link to unlock it early.
+func (app *application) recordLoginFailure(r *http.Request, email string, user *data.User) error {
+
+	app.recordAuthEvent(r, data.AuthEventLoginFailed, email, user)
+
+	ip := realip.FromRequest(r)
+
+	_, err := app.models.LoginThrottle.RecordFailure(data.LoginThrottleIPKey(ip), app.config.login.ipLockoutThreshold, app.config.login.lockoutDuration)
+	if err != nil {
+		return err
+	}
+
+	locked, err := app.models.LoginThrottle.RecordFailure(data.LoginThrottleEmailKey(email), app.config.login.lockoutThreshold, app.config.login.lockoutDuration)
+	if err != nil {
+		return err
+	}
+
+	if !locked {
+		return nil
+	}
+
+	app.recordAuthEvent(r, data.AuthEventAccountLocked, email, user)
+
+	if user == nil || user.ServiceAccount {
+		return nil
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeAccountUnlock, user.ID)
+	if err != nil {
+		return err
+	}
+
+	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAccountUnlock)
+	if err != nil {
+		return err
+	}
+
+	app.background(func() {
+
+		data := map[string]any{
+			"unlockToken":     token.PlainText,
+			"lockoutDuration": app.config.login.lockoutDuration.String(),
+			"ip":              ip,
+		}
+
+		err := app.mailer.Send(user.Email, "account_locked.tmpl", data)
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+	})
+
+	return nil
+
+}
+
+func (app *application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlainText(v, input.Token); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopeAccountUnlock, input.Token)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddError("token", "invalid or expired unlock token")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.models.LoginThrottle.Reset(data.LoginThrottleEmailKey(user.Email))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeAccountUnlock, user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.recordAuthEvent(r, data.AuthEventAccountUnlocked, user.Email, user)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your account was successfully unlocked"}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
@@ -3,16 +3,21 @@ package main
 import (
 	"context"
 	"database/sql"
+	"expvar"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/ishowdarkside/go-movies-app/internal/data"
+	"github.com/ishowdarkside/go-movies-app/internal/jwt"
 	"github.com/ishowdarkside/go-movies-app/internal/mailer"
+	"github.com/ishowdarkside/go-movies-app/internal/passhash"
+	"github.com/ishowdarkside/go-movies-app/internal/passpolicy"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -42,14 +47,60 @@ type config struct {
 		password string
 		sender   string
 	}
+
+	throttle struct {
+		emailInterval time.Duration
+	}
+
+	accounts struct {
+		deletionGracePeriod time.Duration
+		exportTTL           time.Duration
+	}
+
+	permissions struct {
+		cacheTTL    time.Duration
+		cacheNotify bool
+	}
+
+	maintenance struct {
+		interval       time.Duration
+		unactivatedAge time.Duration
+	}
+
+	passwords struct {
+		minScore      int
+		blocklistFile string
+		breachDir     string
+	}
+
+	login struct {
+		lockoutThreshold   int
+		ipLockoutThreshold int
+		lockoutDuration    time.Duration
+	}
+
+	auth struct {
+		mode       string
+		accessTTL  time.Duration
+		refreshTTL time.Duration
+		jwtKeys    string
+		oauthTTL   time.Duration
+
+		mfaPermissions []string
+		defaultRole    string
+	}
 }
 
 type application struct {
-	config config
-	logger *slog.Logger
-	models data.Models
-	mailer *mailer.Mailer
-	wg     sync.WaitGroup
+	config          config
+	logger          *slog.Logger
+	models          data.Models
+	mailer          *mailer.Mailer
+	signingKeys     *jwt.Keyset
+	emailThrottle   *throttle
+	permissionCache *data.PermissionCache
+	passwordPolicy  *passpolicy.Policy
+	wg              sync.WaitGroup
 }
 
 func main() {
@@ -59,6 +110,8 @@ func main() {
 	godotenv.Load()
 	var cfg config
 
+	cfg.auth.mfaPermissions = []string{"movies:write", "movies:write:any"}
+
 	os.Setenv("MOVIE_API_DB_DSN", os.Getenv("DB_LINK"))
 
 	// Parsing flags
@@ -84,6 +137,46 @@ func main() {
 	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("SMTP_PASSWORD"), "SMTP password")
 	flag.StringVar(&cfg.smtp.sender, "smtp-sener", os.Getenv("SMTP_SENDER"), "SMTP sender")
 
+	flag.StringVar(&cfg.auth.mode, "auth-mode", "opaque", "Access token format (opaque|jwt)")
+	flag.StringVar(&cfg.auth.jwtKeys, "auth-jwt-keys", os.Getenv("AUTH_JWT_KEYS"), "Comma-separated kid:secret signing keys for jwt mode; the first one signs new tokens")
+	flag.DurationVar(&cfg.auth.accessTTL, "auth-access-ttl", 24*time.Hour, "Lifetime of authentication (access) tokens")
+	flag.DurationVar(&cfg.auth.refreshTTL, "auth-refresh-ttl", 30*24*time.Hour, "Lifetime of refresh tokens, renewed on every use")
+
+	flag.Func("auth-mfa-required-permissions", "Comma-separated permission codes that require two-factor authentication (default movies:write,movies:write:any)", func(s string) error {
+		cfg.auth.mfaPermissions = strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+		return nil
+	})
+	flag.DurationVar(&cfg.auth.oauthTTL, "auth-oauth-ttl", time.Hour, "Lifetime of OAuth access tokens")
+	flag.StringVar(&cfg.auth.defaultRole, "auth-default-role", "viewer", "Role given to users when they activate their account (empty for none)")
+
+	flag.DurationVar(&cfg.throttle.emailInterval, "throttle-email-interval", 5*time.Minute, "Minimum interval between token emails sent to the same address")
+
+	flag.DurationVar(&cfg.accounts.deletionGracePeriod, "accounts-deletion-grace-period", 30*24*time.Hour, "How long a deleted account can be restored before it is removed for good")
+	flag.DurationVar(&cfg.accounts.exportTTL, "accounts-export-ttl", 48*time.Hour, "How long a personal data export can be downloaded for")
+
+	flag.StringVar(&data.PasswordHashing.Algorithm, "password-hash", passhash.Argon2id, "Algorithm used to hash new passwords (argon2id|bcrypt)")
+	flag.IntVar(&data.PasswordHashing.BcryptCost, "password-bcrypt-cost", passhash.DefaultParams.BcryptCost, "bcrypt cost")
+	flag.Func("password-argon2-memory", "argon2id memory in KiB (default 65536)", parseUint32(&data.PasswordHashing.Memory))
+	flag.Func("password-argon2-iterations", "argon2id iterations (default 3)", parseUint32(&data.PasswordHashing.Iterations))
+	flag.Func("password-argon2-parallelism", "argon2id threads (default 2)", func(s string) error {
+		n, err := strconv.ParseUint(s, 10, 8)
+		data.PasswordHashing.Parallelism = uint8(n)
+		return err
+	})
+	flag.IntVar(&cfg.passwords.minScore, "password-min-score", 2, "Lowest accepted password strength score, from 0 to 4")
+	flag.StringVar(&cfg.passwords.blocklistFile, "password-blocklist-file", "", "File of common passwords to reject, one per line (default built-in list)")
+	flag.StringVar(&cfg.passwords.breachDir, "password-breach-dir", "", "Directory of breached password hash range files named by SHA-1 prefix (empty to disable)")
+
+	flag.DurationVar(&cfg.permissions.cacheTTL, "permissions-cache-ttl", time.Minute, "How long users' permissions are cached in memory (0 to disable)")
+	flag.BoolVar(&cfg.permissions.cacheNotify, "permissions-cache-notify", true, "Listen for grant changes made by other instances via Postgres LISTEN/NOTIFY")
+
+	flag.DurationVar(&cfg.maintenance.interval, "maintenance-interval", time.Hour, "How often expired tokens and stale accounts are cleaned up")
+	flag.DurationVar(&cfg.maintenance.unactivatedAge, "maintenance-unactivated-age", 7*24*time.Hour, "Age after which accounts that were never activated are removed (0 to keep them)")
+
+	flag.IntVar(&cfg.login.lockoutThreshold, "login-lockout-threshold", 10, "Failed sign-ins for an email address before it is locked")
+	flag.IntVar(&cfg.login.ipLockoutThreshold, "login-ip-lockout-threshold", 100, "Failed sign-ins from an IP address before it is locked")
+	flag.DurationVar(&cfg.login.lockoutDuration, "login-lockout-duration", 15*time.Minute, "How long a locked email or IP address is refused sign-ins")
+
 	flag.Parse()
 
 	// Initialize logger
@@ -108,11 +201,68 @@ func main() {
 		return
 	}
 
+	var signingKeys *jwt.Keyset
+
+	switch cfg.auth.mode {
+	case "opaque":
+	case "jwt":
+		signingKeys, err = jwt.ParseKeyset(cfg.auth.jwtKeys)
+		if err != nil {
+
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	default:
+		logger.Error("auth-mode must be opaque or jwt")
+		os.Exit(1)
+	}
+
+	err = data.PasswordHashing.Validate()
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	passwordPolicy, err := passpolicy.New(cfg.passwords.minScore, cfg.passwords.blocklistFile, cfg.passwords.breachDir)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	if cfg.maintenance.interval <= 0 {
+		logger.Error("maintenance-interval must be greater than zero")
+		os.Exit(1)
+	}
+
+	permissionCache := data.NewPermissionCache(cfg.permissions.cacheTTL)
+
+	expvar.Publish("permission_cache", expvar.Func(func() any {
+		return map[string]int64{
+			"hits":   permissionCache.Hits(),
+			"misses": permissionCache.Misses(),
+		}
+	}))
+
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer,
+		config:          cfg,
+		logger:          logger,
+		models:          data.NewModels(db, permissionCache),
+		mailer:          mailer,
+		signingKeys:     signingKeys,
+		emailThrottle:   newThrottle(cfg.throttle.emailInterval),
+		permissionCache: permissionCache,
+		passwordPolicy:  passwordPolicy,
+	}
+
+	// Without the default role newly activated accounts couldn't do
+	// anything, so a typo is caught here rather than on first activation.
+	if cfg.auth.defaultRole != "" {
+
+		_, err = app.models.Roles.Get(cfg.auth.defaultRole)
+		if err != nil {
+			logger.Error(fmt.Sprintf("auth-default-role %q: %s", cfg.auth.defaultRole, err))
+			os.Exit(1)
+		}
 	}
 
 	err = app.serve()
@@ -124,6 +274,16 @@ func main() {
 
 }
 
+func parseUint32(dst *uint32) func(string) error {
+
+	return func(s string) error {
+		n, err := strconv.ParseUint(s, 10, 32)
+		*dst = uint32(n)
+		return err
+	}
+
+}
+
 func openDB(cfg *config) (*sql.DB, error) {
 
 	db, err := sql.Open("postgres", cfg.db.dsn)
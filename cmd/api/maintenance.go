@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"time"
+)
+
+// maintenanceMetrics is published under /debug/vars. The counters are
+// cumulative since the process started.
+var maintenanceMetrics = expvar.NewMap("maintenance")
+
+// startMaintenance runs the periodic clean-up jobs until the returned stop
+// function is called. The loop is tracked by app.wg so shutdown waits for a
+// run in progress to finish.
+func (app *application) startMaintenance() (stop func()) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	app.wg.Add(1)
+
+	go func() {
+
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(app.config.maintenance.interval)
+		defer ticker.Stop()
+
+		for {
+
+			app.runMaintenance()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return cancel
+
+}
+
+// runMaintenance does one round of clean-up. Only one API instance does so
+// at a time; the others skip the round.
+func (app *application) runMaintenance() {
+
+	ran, err := app.models.Maintenance.WithLock(func() {
+
+		start := time.Now()
+
+		app.runMaintenanceJob("expired_tokens_purged", app.models.Tokens.DeleteExpired)
+		app.runMaintenanceJob("expired_exports_removed", app.models.DataExports.DeleteExpired)
+
+		app.runMaintenanceJob("deleted_users_purged", func() (int64, error) {
+			return app.models.Users.PurgeDeleted(app.config.accounts.deletionGracePeriod)
+		})
+
+		if app.config.maintenance.unactivatedAge > 0 {
+			app.runMaintenanceJob("unactivated_users_removed", func() (int64, error) {
+				return app.models.Users.DeleteUnactivated(app.config.maintenance.unactivatedAge)
+			})
+		}
+
+		maintenanceMetrics.Add("runs", 1)
+		maintenanceMetrics.Add("duration_ms_total", time.Since(start).Milliseconds())
+	})
+	if err != nil {
+		maintenanceMetrics.Add("errors", 1)
+		app.logger.Error(err.Error())
+		return
+	}
+
+	if !ran {
+		maintenanceMetrics.Add("skipped", 1)
+	}
+
+}
+
+func (app *application) runMaintenanceJob(name string, job func() (int64, error)) {
+
+	n, err := job()
+	if err != nil {
+		maintenanceMetrics.Add("errors", 1)
+		app.logger.Error(err.Error(), "job", name)
+		return
+	}
+
+	maintenanceMetrics.Add(name, n)
+
+	if n > 0 {
+		app.logger.Info("maintenance job completed", "job", name, "removed", n)
+	}
+
+}
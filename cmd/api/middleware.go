@@ -4,11 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/ishowdarkside/go-movies-app/internal/data"
+	"github.com/ishowdarkside/go-movies-app/internal/jwt"
 	"github.com/ishowdarkside/go-movies-app/internal/validator"
 	"github.com/tomasen/realip"
 	"golang.org/x/time/rate"
@@ -114,6 +116,21 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		headerParts := strings.Split(authorizationHeader, " ")
+
+		// Basic credentials identify OAuth clients, which the OAuth
+		// endpoints authenticate themselves.
+		if len(headerParts) == 2 && headerParts[0] == "Basic" {
+
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(headerParts) == 2 && headerParts[0] == "ApiKey" {
+			app.authenticateAPIKey(w, r, next, headerParts[1])
+			return
+		}
+
 		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
 
 			app.invalidAuthenicationTokenResponse(w, r)
@@ -122,6 +139,48 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		token := headerParts[1]
+
+		if strings.HasPrefix(token, data.OAuthTokenPrefix) {
+			app.authenticateOAuthToken(w, r, next, token)
+			return
+		}
+
+		if app.signingKeys != nil && jwt.LooksLikeToken(token) {
+
+			claims, err := app.verifyAccessToken(token)
+			if err != nil {
+				app.invalidAuthenicationTokenResponse(w, r)
+				return
+			}
+
+			// The signature alone can't tell whether the session has since
+			// been signed out or revoked, so it is looked up like an opaque
+			// token. Permissions come from the cache rather than the claims,
+			// which may be out of date.
+			user, err := app.models.Users.GetForSession(claims.SessionID, claims.UserID())
+			if err != nil {
+
+				if errors.Is(err, data.ErrRecordNotFound) {
+					app.invalidAuthenicationTokenResponse(w, r)
+					return
+				}
+
+				app.serverError(w, r, err)
+				return
+			}
+
+			if user.Deactivated {
+				app.accountDeactivatedResponse(w, r)
+				return
+			}
+
+			r = app.contextSetUser(r, user)
+			r = app.contextSetSession(r, claims.SessionID)
+			r = app.contextSetCredential(r, credentialSession)
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		v := validator.New()
 
 		if data.ValidateTokenPlainText(v, token); !v.Valid() {
@@ -145,12 +204,99 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 
 		}
 
+		if user.Deactivated {
+			app.accountDeactivatedResponse(w, r)
+			return
+		}
+
+		sessionID, err := app.models.Tokens.Touch(token, realip.FromRequest(r), r.UserAgent())
+		if err != nil {
+			app.logError(r, err)
+		}
+
 		r = app.contextSetUser(r, user)
+		r = app.contextSetSession(r, sessionID)
+		r = app.contextSetCredential(r, credentialSession)
 		next.ServeHTTP(w, r)
 
 	})
 }
 
+// authenticateAPIKey authenticates a service account by one of its API keys.
+// The key's own permissions, limited to those the account holds, replace
+// the account's for the request.
+func (app *application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, keyPlainText string) {
+
+	v := validator.New()
+
+	if data.ValidateAPIKeyPlainText(v, keyPlainText); !v.Valid() {
+		app.invalidAPIKeyResponse(w, r)
+		return
+	}
+
+	key, user, err := app.models.APIKeys.GetForKey(keyPlainText)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.invalidAPIKeyResponse(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	// A key can't use more than its service account holds right now, so
+	// revoking a permission from the account takes effect immediately.
+	held, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.models.APIKeys.Touch(key.ID)
+	if err != nil {
+		app.logError(r, err)
+	}
+
+	r = app.contextSetUser(r, user)
+	r = app.contextSetPermissions(r, key.Permissions.Intersect(held))
+	r = app.contextSetCredential(r, credentialAPIKey)
+	next.ServeHTTP(w, r)
+
+}
+
+// authenticateOAuthToken authenticates a request made by an OAuth client.
+// The token's granted scopes replace the user's permissions.
+func (app *application) authenticateOAuthToken(w http.ResponseWriter, r *http.Request, next http.Handler, tokenPlainText string) {
+
+	token, user, err := app.models.OAuthTokens.GetForToken(tokenPlainText)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.invalidAuthenicationTokenResponse(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Scopes granted earlier stop working as soon as the user loses the
+	// matching permission.
+	held, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	r = app.contextSetUser(r, user)
+	r = app.contextSetPermissions(r, token.Scopes.Intersect(held))
+	r = app.contextSetCredential(r, credentialOAuth)
+	next.ServeHTTP(w, r)
+
+}
+
 func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -167,6 +313,27 @@ func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.Han
 	})
 
 }
+
+// requireSessionUser only lets through users signed in with a session of
+// their own, turning away API keys and OAuth access tokens. It guards the
+// endpoints that manage the account, its credentials and its sessions.
+func (app *application) requireSessionUser(next http.HandlerFunc) http.HandlerFunc {
+
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if app.contextGetCredential(r) != credentialSession {
+			app.sessionRequiredResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+
+	})
+
+	return app.requireAuthenticatedUser(fn)
+
+}
+
 func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
 
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -188,22 +355,38 @@ func (app *application) requireActivatedUser(next http.HandlerFunc) http.Handler
 
 func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
 
+	return app.requireAnyPermission([]string{code}, next)
+
+}
+
+// requireAnyPermission lets the request through if the user holds at least
+// one of codes. If every code they hold requires two-factor authentication
+// they must have it turned on.
+func (app *application) requireAnyPermission(codes []string, next http.HandlerFunc) http.HandlerFunc {
+
 	fn := func(w http.ResponseWriter, r *http.Request) {
 
-		user := app.contextGetUser(r)
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		permissions, err := app.permissionsForRequest(r)
 		if err != nil {
 
 			app.serverError(w, r, err)
 			return
 		}
 
-		if !permissions.Include(code) {
+		if !slices.ContainsFunc(codes, permissions.Include) {
 
 			app.notPermittedResponse(w, r)
 			return
 		}
 
+		user := app.contextGetUser(r)
+
+		if !slices.ContainsFunc(codes, func(code string) bool { return app.permitted(user, permissions, code) }) {
+
+			app.twoFactorRequiredResponse(w, r)
+			return
+		}
+
 		next.ServeHTTP(w, r)
 
 	}
@@ -211,3 +394,31 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	return app.requireActivatedUser(fn)
 
 }
+
+// permitted reports whether user may use code: they must hold it, and have
+// two-factor authentication turned on if the code requires it.
+func (app *application) permitted(user *data.User, permissions data.Permissions, code string) bool {
+
+	if !permissions.Include(code) {
+		return false
+	}
+
+	if slices.Contains(app.config.auth.mfaPermissions, code) && !user.TwoFactorEnabled && !user.ServiceAccount {
+		return false
+	}
+
+	return true
+
+}
+
+// permissionsForRequest returns the permissions carried by the request's
+// credential, falling back to the database for opaque session tokens.
+func (app *application) permissionsForRequest(r *http.Request) (data.Permissions, error) {
+
+	if permissions, ok := app.contextGetPermissions(r); ok {
+		return permissions, nil
+	}
+
+	return app.models.Permissions.GetAllForUser(app.contextGetUser(r).ID)
+
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ishowdarkside/go-movies-app/internal/data"
+	"github.com/ishowdarkside/go-movies-app/internal/jwt"
+)
+
+// sessionDriver stands in for Postgres in the session lookup made for signed
+// access tokens. It answers every query with the user whose session ID is
+// the second argument, or no rows if there is no such session.
+type sessionDriver struct {
+	users map[string]*data.User
+}
+
+func (d *sessionDriver) Open(string) (driver.Conn, error) {
+	return &sessionConn{d}, nil
+}
+
+func (d *sessionDriver) Connect(context.Context) (driver.Conn, error) {
+	return d.Open("")
+}
+
+func (d *sessionDriver) Driver() driver.Driver { return d }
+
+type sessionConn struct {
+	d *sessionDriver
+}
+
+func (c *sessionConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *sessionConn) Close() error { return nil }
+
+func (c *sessionConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *sessionConn) QueryContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Rows, error) {
+
+	rows := &sessionRows{}
+
+	if len(args) < 2 {
+		return rows, nil
+	}
+
+	if u, ok := c.d.users[args[1].Value.(string)]; ok && u.ID == args[0].Value.(int64) {
+		rows.values = [][]driver.Value{{u.ID, time.Now(), u.Name, []byte("hash"), u.Activated, u.Email, u.ServiceAccount, u.Deactivated, u.TwoFactorEnabled, int64(1)}}
+	}
+
+	return rows, nil
+
+}
+
+type sessionRows struct {
+	values [][]driver.Value
+}
+
+func (r *sessionRows) Columns() []string {
+	return []string{"id", "created_at", "name", "password_hash", "activated", "email", "service_account", "deactivated", "two_factor", "version"}
+}
+
+func (r *sessionRows) Close() error { return nil }
+
+func (r *sessionRows) Next(dest []driver.Value) error {
+
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+
+	return nil
+
+}
+
+func TestAuthenticateSignedToken(t *testing.T) {
+
+	users := map[string]*data.User{
+		"active-session":      {ID: 1, Name: "Alice", Email: "alice@example.com", Activated: true},
+		"deactivated-session": {ID: 2, Name: "Bob", Email: "bob@example.com", Activated: true, Deactivated: true},
+	}
+
+	db := sql.OpenDB(&sessionDriver{users: users})
+	defer db.Close()
+
+	keys, err := jwt.ParseKeyset("test:0123456789abcdef0123456789abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &application{
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		models:      data.Models{Users: data.UserModel{DB: db}},
+		signingKeys: keys,
+	}
+
+	handler := app.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name      string
+		userID    int64
+		sessionID string
+		want      int
+	}{
+		{"active user", 1, "active-session", http.StatusOK},
+		{"deactivated user", 2, "deactivated-session", http.StatusForbidden},
+		{"revoked session", 1, "revoked-session", http.StatusUnauthorized},
+		{"another user's session", 1, "deactivated-session", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			token, err := keys.Sign(accessClaims{
+				RegisteredClaims: jwt.RegisteredClaims{
+					Issuer:    accessTokenIssuer,
+					Subject:   strconv.FormatInt(tt.userID, 10),
+					ExpiresAt: time.Now().Add(time.Minute).Unix(),
+				},
+				Activated: true,
+				SessionID: tt.sessionID,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/v1/users/me", nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d; body %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+}
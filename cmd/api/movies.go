@@ -4,19 +4,26 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 
 	"github.com/ishowdarkside/go-movies-app/internal/data"
 	"github.com/ishowdarkside/go-movies-app/internal/validator"
 )
 
+// Contributors holding movies:write:own can add movies and change the ones
+// they added; movies:write:any allows changing every movie.
+var movieWritePermissions = []string{"movies:write:any", "movies:write:own"}
+
 func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
 
 	var input struct {
-		Title   string       `json:"title"`
-		Year    int32        `json:"year,omitempty"`
-		Runtime data.Runtime `json:"runtime,omitempty"`
-		Genres  []string     `json:"genres,omitempty"`
+		Title    string         `json:"title"`
+		Year     int32          `json:"year,omitempty"`
+		Runtime  data.Runtime   `json:"runtime,omitempty"`
+		Genres   []string       `json:"genres,omitempty"`
+		Releases []data.Release `json:"releases,omitempty"`
+		Status   string         `json:"status,omitempty"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -27,14 +34,22 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if input.Status == "" {
+		input.Status = data.StatusReleased
+	}
+
 	movie := &data.Movie{
-		Title:   input.Title,
-		Genres:  input.Genres,
-		Year:    input.Year,
-		Runtime: input.Runtime,
+		CreatedBy: &app.contextGetUser(r).ID,
+		Title:     input.Title,
+		Genres:    input.Genres,
+		Year:      input.Year,
+		Runtime:   input.Runtime,
+		Releases:  input.Releases,
+		Status:    input.Status,
 	}
 
 	v := validator.New()
+	movie.RuntimeFormat = app.readRuntimeFormat(w, r, v)
 	isMovieValid := data.ValidateMovie(v, movie)
 
 	if !isMovieValid {
@@ -70,6 +85,19 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	v := validator.New()
+	runtimeFormat := app.readRuntimeFormat(w, r, v)
+	include := app.readCSV(r.URL.Query(), "include", []string{})
+
+	for _, value := range include {
+		v.Check(validator.PermittedValue(value, "collections", "relationships"), "include", "must only contain collections or relationships")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	movieInstance, err := app.models.Movies.Get(id)
 
 	if err != nil {
@@ -84,6 +112,26 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 
 	}
 
+	movieInstance.RuntimeFormat = runtimeFormat
+
+	if slices.Contains(include, "collections") {
+
+		movieInstance.Collections, err = app.models.Collections.GetAllForMovie(movieInstance.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if slices.Contains(include, "relationships") {
+
+		movieInstance.Relationships, err = app.models.Relationships.GetAllForMovie(movieInstance.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
 	err = app.writeJSON(w, 200, envelope{"movie": movieInstance}, nil)
 
 	if err != nil {
@@ -113,6 +161,17 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	ok, err := app.canWriteMovie(r, movie)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !ok {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
 	if r.Header.Get("X-Expected-Version") != "" {
 
 		if strconv.Itoa(int(movie.Version)) != r.Header.Get("X-Expected-Version") {
@@ -123,16 +182,19 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	var input struct {
-		Title   *string       `json: "title"`
-		Year    *int32        `json: "year"`
-		Runtime *data.Runtime `json: "runtime"`
-		Genres  []string      `json: "genres"`
+		Title    *string        `json:"title"`
+		Year     *int32         `json:"year"`
+		Runtime  *data.Runtime  `json:"runtime"`
+		Genres   []string       `json:"genres"`
+		Releases []data.Release `json:"releases"`
+		Status   *string        `json:"status"`
 	}
 
 	err = app.readJSON(w, r, &input)
 
 	if err != nil {
 		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
 	}
 
 	if input.Year != nil {
@@ -151,7 +213,18 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		movie.Title = *input.Title
 	}
 
+	if input.Releases != nil {
+		movie.Releases = input.Releases
+	}
+
 	v := validator.New()
+	movie.RuntimeFormat = app.readRuntimeFormat(w, r, v)
+
+	if input.Status != nil {
+		data.ValidateStatusTransition(v, movie.Status, *input.Status)
+		movie.Status = *input.Status
+	}
+
 	if !data.ValidateMovie(v, movie) {
 
 		app.failedValidationResponse(w, r, v.Errors)
@@ -182,7 +255,30 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	errorRemovingRecord := app.models.Movies.Delete(id)
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundError(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	ok, err := app.canWriteMovie(r, movie)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !ok {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	errorRemovingRecord := app.models.Movies.Delete(movie.ID)
 	if errorRemovingRecord != nil {
 
 		if errors.Is(errorRemovingRecord, data.ErrRecordNotFound) {
@@ -204,8 +300,11 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
 
 	var input struct {
-		Title  string
-		Genres []string
+		Title    string
+		Genres   []string
+		Tags     []string
+		Statuses []string
+		Release  data.ReleaseFilter
 		data.Filters
 	}
 
@@ -214,11 +313,48 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 
 	input.Title = app.readString(queryString, "title", "")
 	input.Genres = app.readCSV(queryString, "genres", []string{})
+	input.Tags = app.readCSV(queryString, "tags", []string{})
+	input.Statuses = app.readCSV(queryString, "status", []string{})
 	input.Page = app.readInt(queryString, "page", 1, v)
 	input.PageSize = app.readInt(queryString, "page_size", 20, v)
 	input.Sort = app.readString(queryString, "sort_by", "id")
 	input.SortSafelist = []string{"title", "id", "year", "runtime", "-id", "-title", "-year", "-runtime"}
 
+	for i, tag := range input.Tags {
+		input.Tags[i] = data.NormalizeTag(tag)
+		data.ValidateTag(v, "tags", input.Tags[i])
+	}
+	v.Check(validator.Unique(input.Tags), "tags", "must not contain duplicate values")
+
+	for _, status := range input.Statuses {
+		data.ValidateStatus(v, "status", status)
+	}
+
+	runtimeFormat := app.readRuntimeFormat(w, r, v)
+
+	input.Release.Country = app.readString(queryString, "country", "")
+	input.Release.ReleasedIn = app.readString(queryString, "released_in", "")
+	certificationMax := app.readString(queryString, "certification_max", "")
+
+	if input.Release.Country != "" {
+		data.ValidateCountry(v, "country", input.Release.Country)
+	}
+
+	if input.Release.ReleasedIn != "" {
+		data.ValidateCountry(v, "released_in", input.Release.ReleasedIn)
+	}
+
+	if certificationMax != "" {
+
+		v.Check(input.Release.Country != "", "country", "must be provided when filtering by certification_max")
+
+		if input.Release.Country != "" {
+			certifications, ok := data.CertificationsUpTo(input.Release.Country, certificationMax)
+			v.Check(ok, "certification_max", "is not a valid certification for "+input.Release.Country)
+			input.Release.Certifications = certifications
+		}
+	}
+
 	data.ValidateFilters(v, input.Filters)
 
 	if !v.Valid() {
@@ -227,13 +363,17 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Tags, input.Statuses, input.Release, input.Filters)
 	if err != nil {
 
 		app.serverError(w, r, err)
 		return
 	}
 
+	for _, movie := range movies {
+		movie.RuntimeFormat = runtimeFormat
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"metadata": metadata, "movies": movies}, nil)
 	if err != nil {
 		app.serverError(w, r, err)
@@ -241,3 +381,24 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 	}
 
 }
+
+// canWriteMovie checks a loaded movie against the user's write permissions,
+// since requireAnyPermission runs before the owner is known.
+func (app *application) canWriteMovie(r *http.Request, movie *data.Movie) (bool, error) {
+
+	permissions, err := app.permissionsForRequest(r)
+	if err != nil {
+		return false, err
+	}
+
+	user := app.contextGetUser(r)
+
+	if app.permitted(user, permissions, "movies:write:any") {
+		return true, nil
+	}
+
+	owner := movie.CreatedBy != nil && *movie.CreatedBy == user.ID
+
+	return owner && app.permitted(user, permissions, "movies:write:own"), nil
+
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ishowdarkside/go-movies-app/internal/data"
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+)
+
+func (app *application) createOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		Name             string   `json:"name"`
+		Confidential     bool     `json:"confidential"`
+		RedirectURIs     []string `json:"redirect_uris"`
+		Scopes           []string `json:"scopes"`
+		ServiceAccountID *int64   `json:"service_account_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	granterPermissions, err := app.permissionsForRequest(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	client := &data.OAuthClient{
+		Name:             input.Name,
+		Confidential:     input.Confidential,
+		RedirectURIs:     input.RedirectURIs,
+		Scopes:           input.Scopes,
+		ServiceAccountID: input.ServiceAccountID,
+	}
+
+	v := validator.New()
+
+	if data.ValidateOAuthClient(v, client, granterPermissions); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if client.ServiceAccountID != nil {
+
+		account, err := app.models.Users.Get(*client.ServiceAccountID)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+		case err != nil:
+			app.serverError(w, r, err)
+			return
+		}
+
+		if account == nil || !account.ServiceAccount {
+			v.AddError("service_account_id", "must reference an existing service account")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	err = app.models.OAuthClients.Insert(client)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Tokens for a service account are limited to what it holds, so it is
+	// given the scopes the granter approved.
+	if client.ServiceAccountID != nil {
+
+		err = app.models.Permissions.AddForUser(*client.ServiceAccountID, client.Scopes...)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/oauth/clients/%s", client.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"client": client}, headers)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) listOAuthClientsHandler(w http.ResponseWriter, r *http.Request) {
+
+	clients, err := app.models.OAuthClients.GetAll()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"clients": clients}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) deleteOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+
+	err := app.models.OAuthClients.Delete(app.readStringParam(r, "client_id"))
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundError(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "client successfully deleted"}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+// authorizeOAuthClientHandler is called by our own front end once the
+// signed-in user has approved a client's authorization request. It issues
+// an authorization code and returns the URI to send the user back to.
+func (app *application) authorizeOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		ResponseType        string `json:"response_type"`
+		ClientID            string `json:"client_id"`
+		RedirectURI         string `json:"redirect_uri"`
+		Scope               string `json:"scope"`
+		State               string `json:"state"`
+		CodeChallenge       string `json:"code_challenge"`
+		CodeChallengeMethod string `json:"code_challenge_method"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.ResponseType == "code", "response_type", "must be code")
+	data.ValidateCodeChallenge(v, input.CodeChallenge, input.CodeChallengeMethod)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	client, err := app.models.OAuthClients.Get(input.ClientID)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddError("client_id", "must reference a registered client")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !client.AllowsRedirectURI(input.RedirectURI) {
+		v.AddError("redirect_uri", "must be registered for the client")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	userPermissions, err := app.permissionsForRequest(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Without an explicit scope the client gets everything it may ask for
+	// that the user is able to grant.
+	scopes := data.ParseScope(input.Scope)
+	if len(scopes) == 0 {
+
+		for _, code := range client.Scopes {
+			if userPermissions.Include(code) {
+				scopes = append(scopes, code)
+			}
+		}
+	}
+
+	for _, code := range scopes {
+		v.Check(client.Scopes.Include(code), "scope", "must only contain scopes registered for the client")
+		v.Check(userPermissions.Include(code), "scope", "must only contain permissions you hold yourself")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	code := &data.OAuthCode{
+		ClientID:      client.ID,
+		UserID:        app.contextGetUser(r).ID,
+		RedirectURI:   input.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: input.CodeChallenge,
+	}
+
+	err = app.models.OAuthCodes.New(code)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	redirect, err := url.Parse(input.RedirectURI)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	query := redirect.Query()
+	query.Set("code", code.PlainText)
+
+	if input.State != "" {
+		query.Set("state", input.State)
+	}
+
+	redirect.RawQuery = query.Encode()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"redirect_uri": redirect.String()}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+// oauthTokenHandler is the RFC 6749 token endpoint. It takes form-encoded
+// requests and answers in the standard OAuth format rather than our usual
+// envelope so that off-the-shelf client libraries can talk to it.
+func (app *application) oauthTokenHandler(w http.ResponseWriter, r *http.Request) {
+
+	if !app.readOAuthForm(w, r) {
+		return
+	}
+
+	client, authenticated, ok := app.authenticateOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	var (
+		userID int64
+		scopes data.Permissions
+	)
+
+	switch r.PostForm.Get("grant_type") {
+
+	case "client_credentials":
+
+		if !authenticated || !client.AllowsClientCredentials() {
+			app.oauthErrorResponse(w, r, http.StatusBadRequest, "unauthorized_client", "the client is not allowed to use the client_credentials grant")
+			return
+		}
+
+		userID = *client.ServiceAccountID
+		scopes = data.ParseScope(r.PostForm.Get("scope"))
+
+		if len(scopes) == 0 {
+			scopes = client.Scopes
+		}
+
+		for _, code := range scopes {
+
+			if !client.Scopes.Include(code) {
+				app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_scope", fmt.Sprintf("the client may not request the %s scope", code))
+				return
+			}
+		}
+
+	case "authorization_code":
+
+		if client.Confidential && !authenticated {
+			app.oauthErrorResponse(w, r, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+			return
+		}
+
+		code, err := app.models.OAuthCodes.Consume(r.PostForm.Get("code"), client.ID)
+		if err != nil {
+
+			if errors.Is(err, data.ErrRecordNotFound) {
+				app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "the authorization code is invalid or has expired")
+				return
+			}
+
+			app.serverError(w, r, err)
+			return
+		}
+
+		if code.RedirectURI != r.PostForm.Get("redirect_uri") {
+			app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "the redirect_uri does not match the authorization request")
+			return
+		}
+
+		verifier := r.PostForm.Get("code_verifier")
+
+		if !validator.Matches(verifier, data.CodeVerifierRX) || !code.VerifyCodeChallenge(verifier) {
+			app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "the code_verifier does not match the code_challenge")
+			return
+		}
+
+		userID = code.UserID
+		scopes = code.Scopes
+
+	default:
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be client_credentials or authorization_code")
+		return
+	}
+
+	// Scopes are narrowed to what the user or service account holds now, in
+	// case a permission was revoked after the client or code was approved.
+	held, err := app.models.Permissions.GetAllForUser(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	scopes = scopes.Intersect(held)
+
+	token, err := app.models.OAuthTokens.New(client.ID, userID, scopes, app.config.auth.oauthTTL)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"access_token": token.PlainText,
+		"token_type":   "Bearer",
+		"expires_in":   int(app.config.auth.oauthTTL.Seconds()),
+		"scope":        strings.Join(token.Scopes, " "),
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, oauthNoStoreHeaders())
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+// introspectOAuthTokenHandler implements RFC 7662. Clients can only inspect
+// tokens that were issued to them; anything else is reported as inactive.
+func (app *application) introspectOAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
+
+	if !app.readOAuthForm(w, r) {
+		return
+	}
+
+	client, authenticated, ok := app.authenticateOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	if !authenticated {
+		app.oauthErrorResponse(w, r, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	token, _, err := app.models.OAuthTokens.GetForToken(r.PostForm.Get("token"))
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	env := envelope{"active": false}
+
+	if token != nil && token.ClientID == client.ID {
+
+		env = envelope{
+			"active":     true,
+			"scope":      strings.Join(token.Scopes, " "),
+			"client_id":  token.ClientID,
+			"sub":        strconv.FormatInt(token.UserID, 10),
+			"token_type": "Bearer",
+			"iat":        token.CreatedAt.Unix(),
+			"exp":        token.Expiry.Unix(),
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, oauthNoStoreHeaders())
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+// revokeOAuthTokenHandler implements RFC 7009. Unknown tokens, and tokens
+// belonging to other clients, are silently ignored.
+func (app *application) revokeOAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
+
+	if !app.readOAuthForm(w, r) {
+		return
+	}
+
+	client, authenticated, ok := app.authenticateOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	if client.Confidential && !authenticated {
+		app.oauthErrorResponse(w, r, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	err := app.models.OAuthTokens.Revoke(r.PostForm.Get("token"), client.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+}
+
+func (app *application) readOAuthForm(w http.ResponseWriter, r *http.Request) bool {
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+
+	err := r.ParseForm()
+	if err != nil {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", "the request body must be form encoded")
+		return false
+	}
+
+	return true
+
+}
+
+// authenticateOAuthClient identifies the client making a request to one of
+// the OAuth endpoints, by HTTP Basic credentials or client_id and
+// client_secret form fields. Public clients identify themselves with just
+// a client_id, in which case authenticated is false.
+func (app *application) authenticateOAuthClient(w http.ResponseWriter, r *http.Request) (client *data.OAuthClient, authenticated bool, ok bool) {
+
+	id, secret, basic := r.BasicAuth()
+
+	if basic {
+		// RFC 6749 section 2.3.1 form-encodes the credentials before they
+		// are put into the Authorization header.
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	client, err := app.models.OAuthClients.Get(id)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.invalidOAuthClientResponse(w, r, basic)
+			return nil, false, false
+		}
+
+		app.serverError(w, r, err)
+		return nil, false, false
+	}
+
+	if secret == "" && !basic {
+		return client, false, true
+	}
+
+	if !client.Authenticate(secret) {
+		app.invalidOAuthClientResponse(w, r, basic)
+		return nil, false, false
+	}
+
+	return client, true, true
+
+}
+
+func oauthNoStoreHeaders() http.Header {
+
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "no-store")
+	headers.Set("Pragma", "no-cache")
+
+	return headers
+
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/ishowdarkside/go-movies-app/internal/data"
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+)
+
+// checkPasswordPolicy records a validation error under key if a new
+// password for the user breaks the password policy. It is skipped when the
+// password has already failed the basic checks.
+func (app *application) checkPasswordPolicy(v *validator.Validator, key, plainText string, user *data.User) error {
+
+	if _, exists := v.Errors[key]; exists {
+		return nil
+	}
+
+	problem, err := app.passwordPolicy.Check(plainText, user.Name, user.Email)
+	if err != nil {
+		return err
+	}
+
+	v.Check(problem == "", key, problem)
+
+	return nil
+
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/ishowdarkside/go-movies-app/internal/data"
+	"github.com/lib/pq"
+)
+
+// startPermissionListener keeps the permission cache in step with grant
+// changes made by other API instances until the returned stop function is
+// called.
+func (app *application) startPermissionListener(cache *data.PermissionCache) (stop func()) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	listener := pq.NewListener(app.config.db.dsn, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+	})
+
+	err := listener.Listen(data.PermissionsChangedChannel)
+	if err != nil {
+		app.logger.Error(err.Error())
+	}
+
+	app.wg.Add(1)
+
+	go func() {
+
+		defer app.wg.Done()
+		defer listener.Close()
+
+		for {
+
+			select {
+			case <-ctx.Done():
+				return
+			case n := <-listener.Notify:
+
+				// A nil notification means the connection was re-established
+				// and changes may have been missed in the meantime.
+				if n == nil {
+					cache.InvalidateAll()
+					continue
+				}
+
+				cache.HandleNotification(n.Extra)
+
+			case <-time.After(90 * time.Second):
+				go listener.Ping()
+			}
+		}
+	}()
+
+	return cancel
+
+}
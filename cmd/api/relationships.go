@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ishowdarkside/go-movies-app/internal/data"
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+)
+
+func (app *application) createMovieRelationshipHandler(w http.ResponseWriter, r *http.Request) {
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundError(w, r)
+		return
+	}
+
+	var input struct {
+		Type           string `json:"type"`
+		RelatedMovieID int64  `json:"related_movie_id"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundError(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	relationship := &data.Relationship{
+		MovieID:        id,
+		Type:           input.Type,
+		RelatedMovieID: input.RelatedMovieID,
+	}
+
+	v := validator.New()
+
+	if data.ValidateRelationship(v, relationship); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Relationships.Insert(relationship)
+	if err != nil {
+
+		switch {
+		case errors.Is(err, data.ErrUnknownMovie):
+			v.AddError("related_movie_id", "must reference an existing movie")
+		case errors.Is(err, data.ErrDuplicateRelationship):
+			v.AddError("related_movie_id", "this relationship already exists")
+		case errors.Is(err, data.ErrRelationshipCycle):
+			v.AddError("related_movie_id", "would create a cycle in the sequel chain")
+		default:
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"relationship": relationship}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) listMovieRelationshipsHandler(w http.ResponseWriter, r *http.Request) {
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundError(w, r)
+		return
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundError(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	relationships, err := app.models.Relationships.GetAllForMovie(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"relationships": relationships}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) deleteMovieRelationshipHandler(w http.ResponseWriter, r *http.Request) {
+
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundError(w, r)
+		return
+	}
+
+	relationshipID, err := app.readNamedIDParam(r, "relationship_id")
+	if err != nil {
+		app.notFoundError(w, r)
+		return
+	}
+
+	err = app.models.Relationships.Delete(movieID, relationshipID)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundError(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "relationship successfully deleted"}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
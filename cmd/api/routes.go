@@ -1,6 +1,7 @@
 package main
 
 import (
+	"expvar"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
@@ -11,17 +12,100 @@ func (app *application) routes() http.Handler {
 	router := httprouter.New()
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/debug/vars", app.requirePermission("metrics:read", expvar.Handler().ServeHTTP))
 
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requireAnyPermission(movieWritePermissions, app.createMovieHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requireAnyPermission(movieWritePermissions, app.updateMovieHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requireAnyPermission(movieWritePermissions, app.deleteMovieHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/relationships", app.requirePermission("movies:read", app.listMovieRelationshipsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/relationships", app.requirePermission("movies:write", app.createMovieRelationshipHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/relationships/:relationship_id", app.requirePermission("movies:write", app.deleteMovieRelationshipHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/tags", app.requirePermission("movies:read", app.listMovieTagsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/tags", app.requireActivatedUser(app.addMovieTagHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/tags/:tag", app.requirePermission("tags:moderate", app.deleteMovieTagHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/tags/:tag/vote", app.requireActivatedUser(app.deleteMovieTagVoteHandler))
+
+	// Tag endpoints
+	router.HandlerFunc(http.MethodGet, "/v1/tags", app.requirePermission("movies:read", app.listTagsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tags/:tag", app.requirePermission("tags:moderate", app.deleteTagHandler))
+
+	// Collection endpoints
+	router.HandlerFunc(http.MethodGet, "/v1/collections", app.requirePermission("movies:read", app.listCollectionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/collections", app.requirePermission("movies:write", app.createCollectionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/collections/:id", app.requirePermission("movies:read", app.showCollectionHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/collections/:id", app.requirePermission("movies:write", app.updateCollectionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/collections/:id", app.requirePermission("movies:write", app.deleteCollectionHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/collections/:id/movies", app.requirePermission("movies:write", app.updateCollectionMoviesHandler))
 
 	// User endpoints
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/unlocked", app.unlockUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/restored", app.restoreUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/email", app.confirmEmailChangeHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me", app.requireSessionUser(app.showCurrentUserHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", app.requireSessionUser(app.updateCurrentUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", app.requireSessionUser(app.deleteCurrentUserHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/export", app.requireSessionUser(app.exportCurrentUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/email", app.requireSessionUser(app.requireActivatedUser(app.requestEmailChangeHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/password", app.requireSessionUser(app.changeCurrentUserPasswordHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/sessions", app.requireSessionUser(app.listCurrentUserSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions/:id", app.requireSessionUser(app.deleteCurrentUserSessionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/two-factor", app.requireSessionUser(app.enrolTwoFactorHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/two-factor", app.requireSessionUser(app.confirmTwoFactorHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/two-factor", app.requireSessionUser(app.disableTwoFactorHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/two-factor/recovery-codes", app.requireSessionUser(app.regenerateRecoveryCodesHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication", app.requireSessionUser(app.deleteAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication/mfa", app.createMFAAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication/magic-link", app.createMagicLinkAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/magic-link", app.createMagicLinkTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.refreshAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/exports/:token", app.downloadExportHandler)
+
+	// Admin endpoints
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users", app.requirePermission("users:admin", app.listUsersHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id", app.requirePermission("users:admin", app.showUserHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/activated", app.requirePermission("users:admin", app.updateUserActivationHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/password-reset", app.requirePermission("users:admin", app.forcePasswordResetHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.grantUserPermissionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/permissions/:code", app.requirePermission("users:admin", app.revokeUserPermissionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/roles", app.requirePermission("users:admin", app.assignUserRolesHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/roles/:role", app.requirePermission("users:admin", app.removeUserRoleHandler))
+
+	// Role endpoints
+	router.HandlerFunc(http.MethodGet, "/v1/roles", app.requirePermission("roles:manage", app.listRolesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/roles", app.requirePermission("roles:manage", app.createRoleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/roles/:name", app.requirePermission("roles:manage", app.showRoleHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/roles/:name", app.requirePermission("roles:manage", app.updateRoleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/roles/:name", app.requirePermission("roles:manage", app.deleteRoleHandler))
+
+	// Service account endpoints
+	router.HandlerFunc(http.MethodGet, "/v1/service-accounts", app.requirePermission("service-accounts:manage", app.listServiceAccountsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/service-accounts", app.requirePermission("service-accounts:manage", app.createServiceAccountHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/service-accounts/:id", app.requirePermission("service-accounts:manage", app.deleteServiceAccountHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/service-accounts/:id/keys", app.requirePermission("service-accounts:manage", app.listAPIKeysHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/service-accounts/:id/keys", app.requirePermission("service-accounts:manage", app.createAPIKeyHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/service-accounts/:id/keys/:key_id", app.requirePermission("service-accounts:manage", app.showAPIKeyHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/service-accounts/:id/keys/:key_id", app.requirePermission("service-accounts:manage", app.updateAPIKeyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/service-accounts/:id/keys/:key_id", app.requirePermission("service-accounts:manage", app.deleteAPIKeyHandler))
+
+	// OAuth endpoints
+	router.HandlerFunc(http.MethodGet, "/v1/oauth/clients", app.requirePermission("oauth-clients:manage", app.listOAuthClientsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/oauth/clients", app.requirePermission("oauth-clients:manage", app.createOAuthClientHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/oauth/clients/:client_id", app.requirePermission("oauth-clients:manage", app.deleteOAuthClientHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/oauth/authorize", app.requireSessionUser(app.requireActivatedUser(app.authorizeOAuthClientHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/oauth/token", app.oauthTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/oauth/introspect", app.introspectOAuthTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/oauth/revoke", app.revokeOAuthTokenHandler)
 
 	router.NotFound = http.HandlerFunc(app.notFoundError)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
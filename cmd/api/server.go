@@ -26,6 +26,14 @@ func (app *application) serve() error {
 		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
 	}
 
+	stopMaintenance := app.startMaintenance()
+
+	stopPermissionListener := func() {}
+
+	if app.permissionCache != nil && app.config.permissions.cacheNotify {
+		stopPermissionListener = app.startPermissionListener(app.permissionCache)
+	}
+
 	go func() {
 
 		quit := make(chan os.Signal, 1)
@@ -42,6 +50,9 @@ func (app *application) serve() error {
 			shutdownError <- err
 		}
 
+		stopMaintenance()
+		stopPermissionListener()
+
 		app.logger.Info("completiing background tasks", "addr", srv.Addr)
 
 		app.wg.Wait()
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ishowdarkside/go-movies-app/internal/data"
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+)
+
+func (app *application) createServiceAccountHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Service accounts never sign in with a password or receive email, so
+	// both are filled with values nobody knows.
+	user := &data.User{
+		Name:           input.Name,
+		Email:          fmt.Sprintf("%s@service-accounts.invalid", strings.ToLower(rand.Text())),
+		Activated:      true,
+		ServiceAccount: true,
+	}
+
+	err = user.Password.Set(rand.Text() + rand.Text())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Users.Insert(user)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/service-accounts/%d", user.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"service_account": user}, headers)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) listServiceAccountsHandler(w http.ResponseWriter, r *http.Request) {
+
+	users, err := app.models.Users.GetAllServiceAccounts()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"service_accounts": users}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) deleteServiceAccountHandler(w http.ResponseWriter, r *http.Request) {
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundError(w, r)
+		return
+	}
+
+	err = app.models.Users.DeleteServiceAccount(id)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundError(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "service account successfully deleted"}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+// readServiceAccount loads the service account named by the :id parameter,
+// writing an error response and returning false if it can't.
+func (app *application) readServiceAccount(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if !user.ServiceAccount {
+		app.notFoundError(w, r)
+		return nil, false
+	}
+
+	return user, true
+
+}
+
+func (app *application) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		Name        string     `json:"name"`
+		Permissions []string   `json:"permissions"`
+		Expiry      *time.Time `json:"expiry"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	account, ok := app.readServiceAccount(w, r)
+	if !ok {
+		return
+	}
+
+	granterPermissions, err := app.permissionsForRequest(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	key := &data.APIKey{
+		ServiceAccountID: account.ID,
+		Name:             input.Name,
+		Permissions:      input.Permissions,
+		Expiry:           input.Expiry,
+	}
+
+	v := validator.New()
+
+	if data.ValidateAPIKey(v, key, granterPermissions); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.APIKeys.New(key)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundError(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Keys are limited to what their service account holds, so it is given
+	// the permissions the granter approved.
+	err = app.models.Permissions.AddForUser(account.ID, key.Permissions...)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/service-accounts/%d/keys/%d", account.ID, key.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"api_key": key}, headers)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+
+	account, ok := app.readServiceAccount(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := app.models.APIKeys.GetAllForServiceAccount(account.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"api_keys": keys}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) showAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+
+	key, ok := app.readAPIKey(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"api_key": key}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) updateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+
+	key, ok := app.readAPIKey(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Header.Get("X-Expected-Version") != "" {
+
+		if strconv.Itoa(key.Version) != r.Header.Get("X-Expected-Version") {
+			app.editConflictResponse(w, r)
+			return
+		}
+	}
+
+	var input struct {
+		Name        *string    `json:"name"`
+		Permissions []string   `json:"permissions"`
+		Expiry      *time.Time `json:"expiry"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		key.Name = *input.Name
+	}
+
+	if input.Permissions != nil {
+		key.Permissions = input.Permissions
+	}
+
+	if input.Expiry != nil {
+		key.Expiry = input.Expiry
+	}
+
+	granterPermissions, err := app.permissionsForRequest(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateAPIKey(v, key, granterPermissions); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.APIKeys.Update(key)
+	if err != nil {
+
+		if errors.Is(err, data.ErrEditConflict) {
+			app.editConflictResponse(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.models.Permissions.AddForUser(key.ServiceAccountID, key.Permissions...)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"api_key": key}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundError(w, r)
+		return
+	}
+
+	keyID, err := app.readNamedIDParam(r, "key_id")
+	if err != nil {
+		app.notFoundError(w, r)
+		return
+	}
+
+	err = app.models.APIKeys.Delete(id, keyID)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundError(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "API key successfully revoked"}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+// readAPIKey loads the key named by the :id and :key_id parameters, writing
+// an error response and returning false if it can't.
+func (app *application) readAPIKey(w http.ResponseWriter, r *http.Request) (*data.APIKey, bool) {
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundError(w, r)
+		return nil, false
+	}
+
+	keyID, err := app.readNamedIDParam(r, "key_id")
+	if err != nil {
+		app.notFoundError(w, r)
+		return nil, false
+	}
+
+	key, err := app.models.APIKeys.Get(id, keyID)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundError(w, r)
+			return nil, false
+		}
+
+		app.serverError(w, r, err)
+		return nil, false
+	}
+
+	return key, true
+
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// throttle allows an action at most once per interval for each key. It is
+// used to stop an endpoint from being turned into a way of flooding a
+// single mailbox.
+type throttle struct {
+	mu       sync.Mutex
+	interval time.Duration
+	lastSeen map[string]time.Time
+}
+
+func newThrottle(interval time.Duration) *throttle {
+
+	t := &throttle{
+		interval: interval,
+		lastSeen: make(map[string]time.Time),
+	}
+
+	go func() {
+
+		for {
+
+			time.Sleep(time.Minute)
+			t.mu.Lock()
+
+			for key, seen := range t.lastSeen {
+
+				if time.Since(seen) > t.interval {
+					delete(t.lastSeen, key)
+				}
+			}
+
+			t.mu.Unlock()
+		}
+
+	}()
+
+	return t
+
+}
+
+func (t *throttle) Allow(key string) bool {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if seen, ok := t.lastSeen[key]; ok && time.Since(seen) < t.interval {
+		return false
+	}
+
+	t.lastSeen[key] = time.Now()
+	return true
+
+}
@@ -3,10 +3,14 @@ package main
 import (
 	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ishowdarkside/go-movies-app/internal/data"
+	"github.com/ishowdarkside/go-movies-app/internal/jwt"
 	"github.com/ishowdarkside/go-movies-app/internal/validator"
+	"github.com/tomasen/realip"
 )
 
 func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -33,11 +37,31 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
+	retryAfter, err := app.loginRetryAfter(r, input.Email)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if retryAfter > 0 {
+		app.recordAuthEvent(r, data.AuthEventLoginThrottled, input.Email, nil)
+		app.loginThrottledResponse(w, r, retryAfter)
+		return
+	}
+
 	user, err := app.models.Users.GetByEmail(input.Email)
 	if err != nil {
 
 		if errors.Is(err, data.ErrRecordNotFound) {
 
+			data.CompareDummyPassword(input.Password)
+
+			err = app.recordLoginFailure(r, input.Email, nil)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
 			app.invalidCredentialsResponse(w, r)
 			return
 		}
@@ -53,21 +77,666 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
-	if !match {
+	if !match || user.ServiceAccount {
+
+		err = app.recordLoginFailure(r, input.Email, user)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
 		app.invalidCredentialsResponse(w, r)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	// With two-factor authentication the password alone doesn't prove
+	// anything yet, so failures are only forgotten after the second step.
+	if !user.TwoFactorEnabled {
+
+		err = app.models.LoginThrottle.Reset(data.LoginThrottleEmailKey(input.Email))
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	// Signing in is the only time the plaintext is at hand, so it's the
+	// chance to move old hashes over to the current algorithm.
+	if user.Password.NeedsRehash() {
+
+		err = app.models.Users.RehashPassword(user, input.Password)
+		if err != nil {
+			app.logError(r, err)
+		}
+	}
+
+	app.recordAuthEvent(r, data.AuthEventLoginSucceeded, input.Email, user)
+
+	app.completeSignIn(w, r, user)
+
+}
+
+// completeSignIn finishes a sign-in once the user has proved who they are
+// with their first factor. Users with two-factor authentication get a
+// short-lived mfa_token to exchange along with a code; everybody else gets
+// their session tokens straight away.
+func (app *application) completeSignIn(w http.ResponseWriter, r *http.Request, user *data.User) {
+
+	if user.Deactivated {
+		app.accountDeactivatedResponse(w, r)
+		return
+	}
+
+	if user.TwoFactorEnabled {
+
+		token, err := app.models.Tokens.New(user.ID, 5*time.Minute, data.ScopeMFAPending)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusAccepted, envelope{"mfa_token": token}, nil)
+		if err != nil {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	env, err := app.newSessionTokens(r, user, "")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) createMagicLinkTokenHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.emailThrottle.Allow("magic-link:" + strings.ToLower(input.Email)) {
+		app.rateLimitExceededResponse(w, r)
+		return
+	}
+
+	env := envelope{"message": "if an activated account with that email address exists, an email will be sent containing a sign-in link"}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+
+			err = app.writeJSON(w, http.StatusAccepted, env, nil)
+			if err != nil {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	if user.Activated && !user.Deactivated && !user.ServiceAccount {
+
+		err = app.models.Tokens.DeleteAllForUser(data.ScopeMagicLink, user.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		token, err := app.models.Tokens.New(user.ID, 15*time.Minute, data.ScopeMagicLink)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.background(func() {
+
+			data := map[string]any{
+				"magicLinkToken": token.PlainText,
+			}
+
+			err := app.mailer.Send(user.Email, "token_magic_link.tmpl", data)
+			if err != nil {
+				app.logger.Error(err.Error())
+			}
+		})
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) createMagicLinkAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlainText(v, input.Token); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopeMagicLink, input.Token)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddError("token", "invalid or expired sign-in token")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeMagicLink, user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.completeSignIn(w, r, user)
+
+}
+
+// mfaMaxAttempts is how many wrong codes an mfa_token survives.
+const mfaMaxAttempts = 5
+
+// createMFAAuthenticationTokenHandler completes a sign-in for a user with
+// two-factor authentication, exchanging the mfa_token returned with their
+// password for real tokens.
+func (app *application) createMFAAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateTokenPlainText(v, input.MFAToken)
+	data.ValidateTwoFactorCode(v, input.Code)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopeMFAPending, input.MFAToken)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddError("mfa_token", "invalid or expired mfa token")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	if user.Deactivated {
+		app.accountDeactivatedResponse(w, r)
+		return
+	}
+
+	retryAfter, err := app.loginRetryAfter(r, user.Email)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if retryAfter > 0 {
+		app.recordAuthEvent(r, data.AuthEventLoginThrottled, user.Email, user)
+		app.loginThrottledResponse(w, r, retryAfter)
+		return
+	}
+
+	ok, err := app.verifySecondFactor(user.ID, input.Code)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !ok {
+
+		// Wrong codes count towards the account's lockout like wrong
+		// passwords, and after a few the mfa_token is thrown away so the
+		// password has to be entered again.
+		err = app.recordLoginFailure(r, user.Email, user)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		exhausted, err := app.models.LoginThrottle.RecordFailure(data.LoginThrottleMFAKey(user.ID), mfaMaxAttempts, 0)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if exhausted {
+
+			err = app.models.Tokens.DeleteAllForUser(data.ScopeMFAPending, user.ID)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+		}
+
+		v.AddError("code", "is invalid or has already been used")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeMFAPending, user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	for _, key := range []string{data.LoginThrottleEmailKey(user.Email), data.LoginThrottleMFAKey(user.ID)} {
+
+		err = app.models.LoginThrottle.Reset(key)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	env, err := app.newSessionTokens(r, user, "")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
 	if err != nil {
 		app.serverError(w, r, err)
+	}
+
+}
+
+// accessClaims are carried by signed access tokens in jwt mode. The
+// authenticate middleware still checks the session and loads the user, so
+// the rest of the claims are only a hint for clients.
+type accessClaims struct {
+	jwt.RegisteredClaims
+	Activated   bool             `json:"activated"`
+	Permissions data.Permissions `json:"permissions"`
+	TwoFactor   bool             `json:"two_factor"`
+	SessionID   string           `json:"sid"`
+}
+
+func (c *accessClaims) UserID() int64 {
+
+	id, _ := strconv.ParseInt(c.Subject, 10, 64)
+	return id
+
+}
+
+const accessTokenIssuer = "moviesapi"
+
+func (app *application) verifyAccessToken(token string) (*accessClaims, error) {
+
+	var claims accessClaims
+
+	err := app.signingKeys.Verify(token, &claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Issuer != accessTokenIssuer || claims.UserID() < 1 || claims.SessionID == "" {
+		return nil, jwt.ErrInvalidToken
+	}
+
+	return &claims, nil
+
+}
+
+// newSignedAccessToken issues a signed access token for the session. It
+// stops working as soon as the session is signed out or revoked.
+func (app *application) newSignedAccessToken(user *data.User, sessionID string) (*data.Token, error) {
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	token := &data.Token{
+		UserID:    user.ID,
+		Expiry:    now.Add(app.config.auth.accessTTL),
+		Scope:     data.ScopeAuthentication,
+		SessionID: sessionID,
+	}
+
+	claims := accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    accessTokenIssuer,
+			Subject:   strconv.FormatInt(user.ID, 10),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: token.Expiry.Unix(),
+		},
+		Activated:   user.Activated,
+		Permissions: permissions,
+		TwoFactor:   user.TwoFactorEnabled,
+		SessionID:   sessionID,
+	}
+
+	token.PlainText, err = app.signingKeys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+
+}
+
+// newSessionTokens issues an access token and a refresh token for the user.
+// An empty sessionID starts a new session; otherwise the tokens continue an
+// existing one.
+func (app *application) newSessionTokens(r *http.Request, user *data.User, sessionID string) (envelope, error) {
+
+	ip, userAgent := realip.FromRequest(r), r.UserAgent()
+
+	if sessionID == "" {
+		sessionID = data.NewSessionID()
+	}
+
+	var (
+		accessToken *data.Token
+		err         error
+	)
+
+	if app.signingKeys != nil {
+		accessToken, err = app.newSignedAccessToken(user, sessionID)
+	} else {
+		accessToken, err = app.models.Tokens.NewForSession(sessionID, user.ID, app.config.auth.accessTTL, data.ScopeAuthentication, ip, userAgent)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := app.models.Tokens.NewForSession(sessionID, user.ID, app.config.auth.refreshTTL, data.ScopeRefresh, ip, userAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	return envelope{"authentication_token": accessToken, "refresh_token": refreshToken}, nil
+
+}
+
+func (app *application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlainText(v, input.RefreshToken); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	token, err := app.models.Tokens.UseRefreshToken(input.RefreshToken)
+	if err != nil {
+
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidRefreshTokenResponse(w, r)
+		case errors.Is(err, data.ErrRefreshTokenReused):
+			app.logger.Warn("refresh token reused, session revoked", "ip", realip.FromRequest(r))
+			app.invalidRefreshTokenResponse(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	user, err := app.models.Users.Get(token.UserID)
 	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.invalidRefreshTokenResponse(w, r)
+			return
+		}
+
 		app.serverError(w, r, err)
 		return
 	}
 
+	if user.Deactivated {
+		app.accountDeactivatedResponse(w, r)
+		return
+	}
+
+	env, err := app.newSessionTokens(r, user, token.SessionID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Respond the same way whether or not the address belongs to an account,
+	// so this endpoint can't be used to find out who is registered.
+	env := envelope{"message": "if an account with that email address exists, an email will be sent containing password reset instructions"}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+
+			err = app.writeJSON(w, http.StatusAccepted, env, nil)
+			if err != nil {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	if user.Activated {
+
+		err = app.models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.background(func() {
+
+			data := map[string]any{
+				"passwordResetToken": token.PlainText,
+			}
+
+			err := app.mailer.Send(user.Email, "token_password_reset.tmpl", data)
+			if err != nil {
+				app.logger.Error(err.Error())
+			}
+		})
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Throttle on the address itself, before looking it up, so unknown and
+	// known addresses are limited in exactly the same way.
+	if !app.emailThrottle.Allow("activation:" + strings.ToLower(input.Email)) {
+		app.rateLimitExceededResponse(w, r)
+		return
+	}
+
+	env := envelope{"message": "if an account with that email address is awaiting activation, an email will be sent containing activation instructions"}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+
+			err = app.writeJSON(w, http.StatusAccepted, env, nil)
+			if err != nil {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !user.Activated && !user.Deactivated {
+
+		err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.background(func() {
+
+			data := map[string]any{
+				"activationToken": token.PlainText,
+			}
+
+			err := app.mailer.Send(user.Email, "token_activation.tmpl", data)
+			if err != nil {
+				app.logger.Error(err.Error())
+			}
+		})
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := app.contextGetUser(r)
+
+	err := app.models.Tokens.DeleteSession(user.ID, app.contextGetSession(r))
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "you have been successfully signed out"}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
 }
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ishowdarkside/go-movies-app/internal/data"
+	"github.com/ishowdarkside/go-movies-app/internal/totp"
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+)
+
+const totpIssuer = "MoviesAPI"
+
+func (app *application) enrolTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := app.contextGetUser(r)
+
+	tf, err := app.models.TwoFactor.Enrol(user.ID)
+	if err != nil {
+
+		if errors.Is(err, data.ErrTwoFactorEnabled) {
+			app.twoFactorEnabledResponse(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"secret":           tf.Secret,
+		"provisioning_uri": totp.ProvisioningURI(totpIssuer, user.Email, tf.Secret),
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+// confirmTwoFactorHandler switches two-factor authentication on once the
+// user proves their authenticator app is set up, and hands out the initial
+// recovery codes.
+func (app *application) confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTwoFactorCode(v, input.Code); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	tf, err := app.models.TwoFactor.Get(user.ID)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundError(w, r)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	if tf.ConfirmedAt != nil {
+		app.twoFactorEnabledResponse(w, r)
+		return
+	}
+
+	counter, ok := totp.Validate(tf.Secret, input.Code, time.Now(), 1)
+	if ok {
+		err = app.models.TwoFactor.UseCounter(user.ID, counter)
+	}
+
+	if !ok || errors.Is(err, data.ErrRecordNotFound) {
+		v.AddError("code", "is invalid or has already been used")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	codes, err := app.models.TwoFactor.NewRecoveryCodes(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+
+	if !app.readTwoFactorCode(w, r) {
+		return
+	}
+
+	err := app.models.TwoFactor.Delete(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "two-factor authentication successfully disabled"}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+func (app *application) regenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+
+	if !app.readTwoFactorCode(w, r) {
+		return
+	}
+
+	codes, err := app.models.TwoFactor.NewRecoveryCodes(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+
+}
+
+// readTwoFactorCode reads a {"code": ...} body and checks it against the
+// current user's second factor, writing an error response and returning
+// false unless it matches.
+func (app *application) readTwoFactorCode(w http.ResponseWriter, r *http.Request) bool {
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return false
+	}
+
+	v := validator.New()
+
+	if data.ValidateTwoFactorCode(v, input.Code); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	ok, err := app.verifySecondFactor(app.contextGetUser(r).ID, input.Code)
+	if err != nil {
+		app.serverError(w, r, err)
+		return false
+	}
+
+	if !ok {
+		v.AddError("code", "is invalid or has already been used")
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	return true
+
+}
+
+// verifySecondFactor accepts either a current TOTP code or one of the user's
+// unused recovery codes. Each code only works once.
+func (app *application) verifySecondFactor(userID int64, code string) (bool, error) {
+
+	if data.IsRecoveryCode(code) {
+
+		err := app.models.TwoFactor.UseRecoveryCode(userID, code)
+		if err != nil {
+
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	tf, err := app.models.TwoFactor.Get(userID)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if tf.ConfirmedAt == nil {
+		return false, nil
+	}
+
+	counter, ok := totp.Validate(tf.Secret, code, time.Now(), 1)
+	if !ok {
+		return false, nil
+	}
+
+	err = app.models.TwoFactor.UseCounter(userID, counter)
+	if err != nil {
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+
+}
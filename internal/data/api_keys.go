@@ -0,0 +1,273 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+	"github.com/lib/pq"
+)
+
+// APIKeyPrefix marks API keys so they can be told apart from session tokens
+// and spotted by secret scanners.
+const APIKeyPrefix = "mvk_"
+
+// apiKeyDisplayLength is how much of the key is stored in the clear so that
+// users can recognise their keys in listings.
+const apiKeyDisplayLength = len(APIKeyPrefix) + 8
+
+type APIKey struct {
+	ID               int64       `json:"id"`
+	CreatedAt        time.Time   `json:"created_at"`
+	ServiceAccountID int64       `json:"service_account_id"`
+	Name             string      `json:"name"`
+	Prefix           string      `json:"prefix"`
+	PlainText        string      `json:"key,omitempty"`
+	Hash             []byte      `json:"-"`
+	Permissions      Permissions `json:"permissions"`
+	Expiry           *time.Time  `json:"expiry"`
+	LastUsedAt       *time.Time  `json:"last_used_at"`
+	Version          int         `json:"version"`
+}
+
+type APIKeyModel struct {
+	DB *sql.DB
+}
+
+// New generates a key for a service account and stores it. The plaintext is
+// only available on the returned value and cannot be recovered later.
+func (m APIKeyModel) New(key *APIKey) error {
+
+	key.PlainText = APIKeyPrefix + rand.Text()
+	key.Prefix = key.PlainText[:apiKeyDisplayLength]
+
+	hash := sha256.Sum256([]byte(key.PlainText))
+	key.Hash = hash[:]
+
+	if key.Permissions == nil {
+		key.Permissions = Permissions{}
+	}
+
+	query := `
+	INSERT INTO api_keys (user_id, name, prefix, hash, permissions, expiry)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{key.ServiceAccountID, key.Name, key.Prefix, key.Hash, pq.Array([]string(key.Permissions)), key.Expiry}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt, &key.Version)
+	if err != nil {
+
+		if strings.Contains(err.Error(), "violates foreign key constraint") {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	return nil
+
+}
+
+func (m APIKeyModel) Get(serviceAccountID, id int64) (*APIKey, error) {
+
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT id, created_at, user_id, name, prefix, permissions, expiry, last_used_at, version
+	FROM api_keys WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var key APIKey
+
+	err := m.DB.QueryRowContext(ctx, query, id, serviceAccountID).Scan(&key.ID, &key.CreatedAt, &key.ServiceAccountID, &key.Name, &key.Prefix, pq.Array((*[]string)(&key.Permissions)), &key.Expiry, &key.LastUsedAt, &key.Version)
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &key, nil
+
+}
+
+func (m APIKeyModel) GetAllForServiceAccount(serviceAccountID int64) ([]*APIKey, error) {
+
+	query := `
+	SELECT id, created_at, user_id, name, prefix, permissions, expiry, last_used_at, version
+	FROM api_keys WHERE user_id = $1 ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, serviceAccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	keys := []*APIKey{}
+
+	for rows.Next() {
+
+		var key APIKey
+
+		err := rows.Scan(&key.ID, &key.CreatedAt, &key.ServiceAccountID, &key.Name, &key.Prefix, pq.Array((*[]string)(&key.Permissions)), &key.Expiry, &key.LastUsedAt, &key.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+
+}
+
+func (m APIKeyModel) Update(key *APIKey) error {
+
+	query := `
+	UPDATE api_keys SET name = $1, permissions = $2, expiry = $3, version = version + 1
+	WHERE id = $4 AND version = $5
+	RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, key.Name, pq.Array([]string(key.Permissions)), key.Expiry, key.ID, key.Version).Scan(&key.Version)
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+		return err
+	}
+
+	return nil
+
+}
+
+func (m APIKeyModel) Delete(serviceAccountID, id int64) error {
+
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, id, serviceAccountID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+
+}
+
+// GetForKey looks up an unexpired key and the service account it belongs to.
+func (m APIKeyModel) GetForKey(keyPlainText string) (*APIKey, *User, error) {
+
+	query := `
+	SELECT api_keys.id, api_keys.name, api_keys.prefix, api_keys.permissions, api_keys.expiry,
+		users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.service_account, users.version
+	FROM api_keys
+	INNER JOIN users ON users.id = api_keys.user_id
+	WHERE api_keys.hash = $1 AND (api_keys.expiry IS NULL OR api_keys.expiry > NOW()) AND users.service_account AND users.deactivated_at IS NULL`
+
+	hash := sha256.Sum256([]byte(keyPlainText))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var (
+		key  APIKey
+		user User
+	)
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:]).Scan(
+		&key.ID, &key.Name, &key.Prefix, pq.Array((*[]string)(&key.Permissions)), &key.Expiry,
+		&user.ID, &user.CreatedAt, &user.Name, &user.Email, &user.Password.hash, &user.Activated, &user.ServiceAccount, &user.Version,
+	)
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, ErrRecordNotFound
+		}
+		return nil, nil, err
+	}
+
+	key.ServiceAccountID = user.ID
+
+	return &key, &user, nil
+
+}
+
+// Touch records that a key has just been used, at most once a minute.
+func (m APIKeyModel) Touch(id int64) error {
+
+	query := `
+	UPDATE api_keys SET last_used_at = NOW()
+	WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+
+}
+
+func ValidateAPIKeyPlainText(v *validator.Validator, keyPlainText string) {
+
+	v.Check(strings.HasPrefix(keyPlainText, APIKeyPrefix), "key", "must be a valid API key")
+	v.Check(len(keyPlainText) == len(APIKeyPrefix)+26, "key", "must be a valid API key")
+
+}
+
+// ValidateAPIKey checks a key against the permissions of the user granting
+// it, who can't hand out more than they hold themselves.
+func ValidateAPIKey(v *validator.Validator, key *APIKey, granterPermissions Permissions) {
+
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(validator.Unique(key.Permissions), "permissions", "must not contain duplicate values")
+
+	for _, code := range key.Permissions {
+		v.Check(granterPermissions.Include(code), "permissions", "must only contain permissions you hold yourself")
+	}
+
+	if key.Expiry != nil {
+		v.Check(key.Expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+
+}
@@ -0,0 +1,303 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+	"github.com/lib/pq"
+)
+
+type Collection struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"-"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Movies      []*Movie  `json:"movies,omitempty"`
+	Version     int32     `json:"version"`
+}
+
+// MovieCollection is a collection as seen from one of its movies.
+type MovieCollection struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Position int    `json:"position"`
+}
+
+type CollectionModel struct {
+	DB *sql.DB
+}
+
+func (m CollectionModel) Insert(collection *Collection) error {
+
+	query := `INSERT INTO collections (name, description) VALUES ($1, $2) RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, collection.Name, collection.Description).Scan(&collection.ID, &collection.CreatedAt, &collection.Version)
+
+}
+
+func (m CollectionModel) Get(id int64) (*Collection, error) {
+
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	var collection Collection
+
+	query := `SELECT id, created_at, name, description, version FROM collections WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&collection.ID, &collection.CreatedAt, &collection.Name, &collection.Description, &collection.Version)
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &collection, nil
+
+}
+
+func (m CollectionModel) Update(collection *Collection) error {
+
+	query := `UPDATE collections SET name = $1, description = $2, version = version + 1
+	WHERE id = $3 AND version = $4
+	RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, collection.Name, collection.Description, collection.ID, collection.Version).Scan(&collection.Version)
+	if err != nil && errors.Is(err, sql.ErrNoRows) {
+		return ErrEditConflict
+	}
+	return err
+
+}
+
+func (m CollectionModel) Delete(id int64) error {
+
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `DELETE FROM collections WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+
+}
+
+func (m CollectionModel) GetAll(name string, filters Filters) ([]*Collection, Metadata, error) {
+
+	query := fmt.Sprintf(`SELECT count(*) OVER(), id, created_at, name, description, version
+	FROM collections
+	WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+	ORDER BY %s %s, id ASC
+	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	collections := []*Collection{}
+
+	for rows.Next() {
+
+		var collection Collection
+
+		err := rows.Scan(&totalRecords, &collection.ID, &collection.CreatedAt, &collection.Name, &collection.Description, &collection.Version)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		collections = append(collections, &collection)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return collections, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+
+}
+
+// SetMovies replaces the contents of a collection with movieIDs, in viewing
+// order, and bumps the collection version.
+func (m CollectionModel) SetMovies(collection *Collection, movieIDs []int64) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	query := `UPDATE collections SET version = version + 1 WHERE id = $1 AND version = $2 RETURNING version`
+
+	err = tx.QueryRowContext(ctx, query, collection.ID, collection.Version).Scan(&collection.Version)
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM collections_movies WHERE collection_id = $1`, collection.ID)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO collections_movies (collection_id, movie_id, position)
+	SELECT $1, movie_id, position FROM unnest($2::bigint[]) WITH ORDINALITY AS t(movie_id, position)`
+
+	_, err = tx.ExecContext(ctx, query, collection.ID, pq.Array(movieIDs))
+	if err != nil {
+
+		if strings.Contains(err.Error(), "violates foreign key constraint") {
+			return ErrUnknownMovie
+		}
+		return err
+	}
+
+	return tx.Commit()
+
+}
+
+func (m CollectionModel) GetMovies(collectionID int64) ([]*Movie, error) {
+
+	query := `SELECT movies.id, movies.created_at, movies.title, movies.genres, movies.year, movies.runtime, movies.releases, movies.status, movies.version
+	FROM movies
+	INNER JOIN collections_movies ON collections_movies.movie_id = movies.id
+	WHERE collections_movies.collection_id = $1
+	ORDER BY collections_movies.position`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+
+		var movie Movie
+
+		err := rows.Scan(&movie.ID, &movie.CreatedAt, &movie.Title, pq.Array(&movie.Genres), &movie.Year, &movie.Runtime, (*Releases)(&movie.Releases), &movie.Status, &movie.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+
+}
+
+func (m CollectionModel) GetAllForMovie(movieID int64) ([]*MovieCollection, error) {
+
+	query := `SELECT collections.id, collections.name, collections_movies.position
+	FROM collections
+	INNER JOIN collections_movies ON collections_movies.collection_id = collections.id
+	WHERE collections_movies.movie_id = $1
+	ORDER BY collections.name, collections.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	collections := []*MovieCollection{}
+
+	for rows.Next() {
+
+		var collection MovieCollection
+
+		err := rows.Scan(&collection.ID, &collection.Name, &collection.Position)
+		if err != nil {
+			return nil, err
+		}
+
+		collections = append(collections, &collection)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return collections, nil
+
+}
+
+func ValidateCollection(v *validator.Validator, collection *Collection) {
+
+	v.Check(collection.Name != "", "name", "must be provided")
+	v.Check(len(collection.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(len(collection.Description) <= 5000, "description", "must not be more than 5000 bytes long")
+
+}
+
+func ValidateCollectionMovies(v *validator.Validator, movieIDs []int64) {
+
+	v.Check(movieIDs != nil, "movies", "must be provided")
+	v.Check(len(movieIDs) <= 500, "movies", "must not contain more than 500 movies")
+	v.Check(validator.Unique(movieIDs), "movies", "must not contain duplicate values")
+
+	for _, id := range movieIDs {
+		v.Check(id > 0, "movies", "must only contain valid movie ids")
+	}
+
+}
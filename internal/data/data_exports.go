@@ -0,0 +1,159 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type DataExport struct {
+	PlainText string    `json:"-"`
+	UserID    int64     `json:"-"`
+	Expiry    time.Time `json:"expiry"`
+}
+
+type DataExportModel struct {
+	DB *sql.DB
+}
+
+// New gathers everything held about the user into a JSON archive and stores
+// it behind a download token valid for ttl.
+func (m DataExportModel) New(userID int64, ttl time.Duration) (*DataExport, error) {
+
+	export := &DataExport{
+		PlainText: rand.Text(),
+		UserID:    userID,
+		Expiry:    time.Now().Add(ttl),
+	}
+
+	hash := sha256.Sum256([]byte(export.PlainText))
+
+	query := `
+	INSERT INTO data_exports (user_id, hash, expiry, archive)
+	SELECT users.id, $2, $3, json_build_object(
+		'generated_at', NOW(),
+		'user', json_build_object(
+			'id', users.id,
+			'created_at', users.created_at,
+			'name', users.name,
+			'email', users.email,
+			'activated', users.activated,
+			'two_factor_enabled', EXISTS (SELECT 1 FROM user_totp WHERE user_totp.user_id = users.id AND user_totp.confirmed_at IS NOT NULL)
+		),
+		'pending_email_change', (
+			SELECT json_build_object('email', email, 'created_at', created_at)
+			FROM email_changes WHERE email_changes.user_id = users.id
+		),
+		'roles', COALESCE((
+			SELECT json_agg(roles.name ORDER BY roles.name)
+			FROM roles INNER JOIN users_roles ON users_roles.role_id = roles.id
+			WHERE users_roles.user_id = users.id
+		), '[]'),
+		'permissions', COALESCE((
+			SELECT json_agg(permissions.code ORDER BY permissions.code)
+			FROM permissions INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+			WHERE users_permissions.user_id = users.id
+		), '[]'),
+		'tokens', COALESCE((
+			SELECT json_agg(json_build_object(
+				'scope', scope, 'created_at', created_at, 'last_used_at', last_used_at,
+				'expiry', expiry, 'ip', ip, 'user_agent', user_agent
+			) ORDER BY created_at)
+			FROM tokens WHERE tokens.user_id = users.id
+		), '[]'),
+		'oauth_grants', COALESCE((
+			SELECT json_agg(json_build_object(
+				'client_id', oauth_clients.id, 'client_name', oauth_clients.name,
+				'scopes', oauth_tokens.scopes, 'created_at', oauth_tokens.created_at, 'expiry', oauth_tokens.expiry
+			) ORDER BY oauth_tokens.created_at)
+			FROM oauth_tokens INNER JOIN oauth_clients ON oauth_clients.id = oauth_tokens.client_id
+			WHERE oauth_tokens.user_id = users.id
+		), '[]'),
+		'movies_created', COALESCE((
+			SELECT json_agg(json_build_object('id', id, 'title', title, 'created_at', created_at) ORDER BY id)
+			FROM movies WHERE movies.created_by = users.id
+		), '[]'),
+		'tags_added', COALESCE((
+			SELECT json_agg(json_build_object('movie_id', movies_tags.movie_id, 'tag', tags.name, 'created_at', movies_tags.created_at) ORDER BY movies_tags.created_at)
+			FROM movies_tags INNER JOIN tags ON tags.id = movies_tags.tag_id
+			WHERE movies_tags.added_by = users.id
+		), '[]'),
+		'tag_votes', COALESCE((
+			SELECT json_agg(json_build_object('movie_id', movies_tags_votes.movie_id, 'tag', tags.name, 'created_at', movies_tags_votes.created_at) ORDER BY movies_tags_votes.created_at)
+			FROM movies_tags_votes INNER JOIN tags ON tags.id = movies_tags_votes.tag_id
+			WHERE movies_tags_votes.user_id = users.id
+		), '[]'),
+		'auth_events', COALESCE((
+			SELECT json_agg(json_build_object(
+				'event', event, 'created_at', created_at, 'ip', ip, 'user_agent', user_agent
+			) ORDER BY created_at)
+			FROM auth_events WHERE auth_events.user_id = users.id
+		), '[]')
+	)
+	FROM users WHERE users.id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, userID, hash[:], export.Expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return export, nil
+
+}
+
+// GetArchiveForToken returns the JSON archive behind an unexpired download
+// token.
+func (m DataExportModel) GetArchiveForToken(plainText string) ([]byte, error) {
+
+	query := `SELECT archive FROM data_exports WHERE hash = $1 AND expiry > NOW()`
+
+	hash := sha256.Sum256([]byte(plainText))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var archive []byte
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:]).Scan(&archive)
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return archive, nil
+
+}
+
+func (m DataExportModel) DeleteExpired() (int64, error) {
+
+	query := `DELETE FROM data_exports WHERE expiry < NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+
+}
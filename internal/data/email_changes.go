@@ -0,0 +1,61 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// EmailChangeModel holds the address a user has asked to move to until they
+// confirm it with the token sent to that address.
+type EmailChangeModel struct {
+	DB *sql.DB
+}
+
+func (m EmailChangeModel) Insert(userID int64, email string) error {
+
+	query := `INSERT INTO email_changes (user_id, email) VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET email = EXCLUDED.email, created_at = NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, email)
+	return err
+
+}
+
+func (m EmailChangeModel) Get(userID int64) (string, error) {
+
+	var email string
+
+	query := `SELECT email FROM email_changes WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&email)
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrRecordNotFound
+		}
+		return "", err
+	}
+
+	return email, nil
+
+}
+
+func (m EmailChangeModel) Delete(userID int64) error {
+
+	query := `DELETE FROM email_changes WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+
+}
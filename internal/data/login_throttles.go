@@ -0,0 +1,203 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// loginBackoffAfter is the number of failures allowed in quick succession
+	// before each further attempt has to wait, doubling every time.
+	loginBackoffAfter = 3
+	loginBackoffMax   = 5 * time.Minute
+
+	// loginFailureWindow is how long failures are remembered for once the
+	// attempts stop.
+	loginFailureWindow = time.Hour
+)
+
+const (
+	AuthEventLoginSucceeded  = "login_succeeded"
+	AuthEventLoginFailed     = "login_failed"
+	AuthEventLoginThrottled  = "login_throttled"
+	AuthEventAccountLocked   = "account_locked"
+	AuthEventAccountUnlocked = "account_unlocked"
+)
+
+type LoginThrottle struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// RetryAfter returns how long the client has to wait before another
+// attempt will be considered, or zero if it can try now.
+func (t *LoginThrottle) RetryAfter(now time.Time) time.Duration {
+
+	if t.LockedUntil != nil && now.Before(*t.LockedUntil) {
+		return t.LockedUntil.Sub(now)
+	}
+
+	if t.Failures < loginBackoffAfter {
+		return 0
+	}
+
+	delay := min(time.Second<<min(t.Failures-loginBackoffAfter, 16), loginBackoffMax)
+
+	return max(t.LastFailureAt.Add(delay).Sub(now), 0)
+
+}
+
+func LoginThrottleEmailKey(email string) string {
+
+	return "email:" + strings.ToLower(email)
+
+}
+
+func LoginThrottleIPKey(ip string) string {
+
+	return "ip:" + ip
+
+}
+
+// LoginThrottleMFAKey counts wrong second factor codes entered for the user
+// during sign-in.
+func LoginThrottleMFAKey(userID int64) string {
+
+	return "mfa:" + strconv.FormatInt(userID, 10)
+
+}
+
+type LoginThrottleModel struct {
+	DB *sql.DB
+}
+
+// RetryAfter returns the longest wait imposed by any of keys.
+func (m LoginThrottleModel) RetryAfter(keys ...string) (time.Duration, error) {
+
+	query := `
+	SELECT key, failures, last_failure_at, locked_until FROM login_throttles
+	WHERE key = ANY($1) AND (last_failure_at > NOW() - $2 * INTERVAL '1 second' OR locked_until > NOW())`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(keys), loginFailureWindow.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	defer rows.Close()
+
+	var retryAfter time.Duration
+	now := time.Now()
+
+	for rows.Next() {
+
+		var t LoginThrottle
+
+		err := rows.Scan(&t.Key, &t.Failures, &t.LastFailureAt, &t.LockedUntil)
+		if err != nil {
+			return 0, err
+		}
+
+		retryAfter = max(retryAfter, t.RetryAfter(now))
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	return retryAfter, nil
+
+}
+
+// RecordFailure counts a failed attempt against key. Once lockThreshold
+// failures have built up the key is locked for lockFor and the count starts
+// again; locked reports whether this failure caused that.
+func (m LoginThrottleModel) RecordFailure(key string, lockThreshold int, lockFor time.Duration) (locked bool, err error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO login_throttles (key, failures, last_failure_at) VALUES ($1, 1, NOW())
+	ON CONFLICT (key) DO UPDATE SET
+		failures = CASE
+			WHEN login_throttles.last_failure_at < NOW() - $2 * INTERVAL '1 second' THEN 1
+			ELSE login_throttles.failures + 1
+		END,
+		last_failure_at = NOW()
+	RETURNING failures`
+
+	var failures int
+
+	err = tx.QueryRowContext(ctx, query, key, loginFailureWindow.Seconds()).Scan(&failures)
+	if err != nil {
+		return false, err
+	}
+
+	if failures >= lockThreshold {
+
+		query = `UPDATE login_throttles SET failures = 0, locked_until = NOW() + $2 * INTERVAL '1 second' WHERE key = $1`
+
+		_, err = tx.ExecContext(ctx, query, key, lockFor.Seconds())
+		if err != nil {
+			return false, err
+		}
+
+		locked = true
+	}
+
+	return locked, tx.Commit()
+
+}
+
+func (m LoginThrottleModel) Reset(key string) error {
+
+	query := `DELETE FROM login_throttles WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, key)
+	return err
+
+}
+
+type AuthEvent struct {
+	Event     string
+	UserID    *int64
+	Email     string
+	IP        string
+	UserAgent string
+}
+
+type AuthEventModel struct {
+	DB *sql.DB
+}
+
+func (m AuthEventModel) Insert(event *AuthEvent) error {
+
+	query := `INSERT INTO auth_events (event, user_id, email, ip, user_agent) VALUES ($1, $2, $3, $4, $5)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, event.Event, event.UserID, event.Email, event.IP, truncate(event.UserAgent, 512))
+	return err
+
+}
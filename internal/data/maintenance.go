@@ -0,0 +1,57 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// maintenanceLockID identifies the advisory lock held while the clean-up
+// jobs run. Any constant works as long as nothing else uses it.
+const maintenanceLockID = 4_207_281_047
+
+type MaintenanceModel struct {
+	DB *sql.DB
+}
+
+// WithLock runs fn while holding a database-wide advisory lock, so that only
+// one API instance does the work at a time. It returns false without
+// calling fn if another instance holds the lock.
+func (m MaintenanceModel) WithLock(fn func()) (bool, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Session-level advisory locks belong to a connection, so the same
+	// connection has to be used to take and release it.
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	defer conn.Close()
+
+	var locked bool
+
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, maintenanceLockID).Scan(&locked)
+	if err != nil {
+		return false, err
+	}
+
+	if !locked {
+		return false, nil
+	}
+
+	defer func() {
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, maintenanceLockID)
+	}()
+
+	fn()
+
+	return true, nil
+
+}
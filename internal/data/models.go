@@ -7,15 +7,49 @@ import (
 
 var ErrRecordNotFound = errors.New("record not found")
 var ErrEditConflict = errors.New("edit conflict")
+var ErrUnknownMovie = errors.New("unknown movie")
 
 type Models struct {
-	Movies      MovieModel
-	Users       UserModel
-	Tokens      TokenModel
-	Permissions PermissionModel
+	Movies        MovieModel
+	Users         UserModel
+	Tokens        TokenModel
+	Permissions   PermissionModel
+	Collections   CollectionModel
+	Relationships RelationshipModel
+	Tags          TagModel
+	EmailChanges  EmailChangeModel
+	APIKeys       APIKeyModel
+	OAuthClients  OAuthClientModel
+	OAuthCodes    OAuthCodeModel
+	OAuthTokens   OAuthTokenModel
+	TwoFactor     TwoFactorModel
+	LoginThrottle LoginThrottleModel
+	AuthEvents    AuthEventModel
+	Roles         RoleModel
+	DataExports   DataExportModel
+	Maintenance   MaintenanceModel
 }
 
-func NewModels(db *sql.DB) Models {
+func NewModels(db *sql.DB, permissionCache *PermissionCache) Models {
 
-	return Models{Movies: MovieModel{DB: db}, Users: UserModel{DB: db}, Tokens: TokenModel{DB: db}, Permissions: PermissionModel{DB: db}}
+	return Models{
+		Movies:        MovieModel{DB: db},
+		Users:         UserModel{DB: db},
+		Tokens:        TokenModel{DB: db},
+		Permissions:   PermissionModel{DB: db, Cache: permissionCache},
+		Collections:   CollectionModel{DB: db},
+		Relationships: RelationshipModel{DB: db},
+		Tags:          TagModel{DB: db},
+		EmailChanges:  EmailChangeModel{DB: db},
+		APIKeys:       APIKeyModel{DB: db},
+		OAuthClients:  OAuthClientModel{DB: db},
+		OAuthCodes:    OAuthCodeModel{DB: db},
+		OAuthTokens:   OAuthTokenModel{DB: db},
+		TwoFactor:     TwoFactorModel{DB: db},
+		LoginThrottle: LoginThrottleModel{DB: db},
+		AuthEvents:    AuthEventModel{DB: db},
+		Roles:         RoleModel{DB: db, Cache: permissionCache},
+		DataExports:   DataExportModel{DB: db},
+		Maintenance:   MaintenanceModel{DB: db},
+	}
 }
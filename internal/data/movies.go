@@ -3,6 +3,7 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -17,13 +18,13 @@ type MovieModel struct {
 
 func (m MovieModel) Insert(movie *Movie) error {
 
-	query := `INSERT INTO movies (title, year, runtime, genres) VALUES ($1, $2, $3, $4) RETURNING id, created_at, version`
+	query := `INSERT INTO movies (title, year, runtime, genres, releases, status, created_by) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at, version`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 
 	defer cancel()
 
-	res := m.DB.QueryRowContext(ctx, query, movie.Title, movie.Year, movie.Runtime, pq.StringArray(movie.Genres))
+	res := m.DB.QueryRowContext(ctx, query, movie.Title, movie.Year, movie.Runtime, pq.StringArray(movie.Genres), Releases(movie.Releases), movie.Status, movie.CreatedBy)
 
 	return res.Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
 }
@@ -35,13 +36,13 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	}
 	moviePlaceholder := Movie{}
 
-	query := `SELECT  id, title, genres, runtime, year, created_at, version  FROM movies WHERE id = $1`
+	query := `SELECT  id, title, genres, runtime, year, releases, status, created_at, created_by, version  FROM movies WHERE id = $1`
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(&moviePlaceholder.ID, &moviePlaceholder.Title, pq.Array(&moviePlaceholder.Genres), &moviePlaceholder.Runtime, &moviePlaceholder.Year, &moviePlaceholder.CreatedAt, &moviePlaceholder.Version)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&moviePlaceholder.ID, &moviePlaceholder.Title, pq.Array(&moviePlaceholder.Genres), &moviePlaceholder.Runtime, &moviePlaceholder.Year, (*Releases)(&moviePlaceholder.Releases), &moviePlaceholder.Status, &moviePlaceholder.CreatedAt, &moviePlaceholder.CreatedBy, &moviePlaceholder.Version)
 
 	if err != nil {
 
@@ -60,15 +61,15 @@ func (m MovieModel) Update(movie *Movie) error {
 		return ErrRecordNotFound
 	}
 
-	query := `UPDATE movies SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1 
-	WHERE id = $5 AND version = $6
+	query := `UPDATE movies SET title = $1, year = $2, runtime = $3, genres = $4, releases = $5, status = $6, version = version + 1 
+	WHERE id = $7 AND version = $8
 	RETURNING version`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ID, movie.Version).Scan(&movie.Version)
+	err := m.DB.QueryRowContext(ctx, query, movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), Releases(movie.Releases), movie.Status, movie.ID, movie.Version).Scan(&movie.Version)
 
 	if err != nil && errors.Is(err, sql.ErrNoRows) {
 		return ErrEditConflict
@@ -107,19 +108,29 @@ func (m MovieModel) Delete(id int64) error {
 
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+func (m MovieModel) GetAll(title string, genres []string, tags []string, statuses []string, release ReleaseFilter, filters Filters) ([]*Movie, Metadata, error) {
 
 	ctx, close := context.WithTimeout(context.Background(), time.Second*3)
-	query := fmt.Sprintf(`SELECT count(*) OVER(), id, created_at, title, genres, year, runtime, version 
+	query := fmt.Sprintf(`SELECT count(*) OVER(), id, created_at, created_by, title, genres, year, runtime, releases, status, version 
 	FROM movies	WHERE
 	(to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '') AND
-	(genres @> $2 OR $2 = '{}')
+	(genres @> $2 OR $2 = '{}') AND
+	(cardinality($3::text[]) = 0 OR (
+		SELECT count(*) FROM movies_tags INNER JOIN tags ON tags.id = movies_tags.tag_id
+		WHERE movies_tags.movie_id = movies.id AND tags.name = ANY($3)) = cardinality($3::text[])) AND
+	(status = ANY($4) OR $4 = '{}') AND
+	($5 = '' OR EXISTS (
+		SELECT 1 FROM jsonb_array_elements(releases) r
+		WHERE r->>'country' = $5 AND (cardinality($6::text[]) = 0 OR r->>'certification' = ANY($6)))) AND
+	($7 = '' OR EXISTS (
+		SELECT 1 FROM jsonb_array_elements(releases) r
+		WHERE r->>'country' = $7 AND (r->>'date')::date <= CURRENT_DATE))
 	ORDER BY %s %s, id ASC
-	LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+	LIMIT $8 OFFSET $9`, filters.sortColumn(), filters.sortDirection())
 
 	defer close()
 
-	rows, err := m.DB.QueryContext(ctx, query, title, pq.Array(genres), filters.limit(), filters.offset())
+	rows, err := m.DB.QueryContext(ctx, query, title, pq.Array(genres), pq.Array(tags), pq.Array(statuses), release.Country, pq.Array(release.Certifications), release.ReleasedIn, filters.limit(), filters.offset())
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -133,7 +144,7 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 
 		currMovie := Movie{}
 
-		err := rows.Scan(&totalRecord, &currMovie.ID, &currMovie.CreatedAt, &currMovie.Title, pq.Array(&currMovie.Genres), &currMovie.Year, &currMovie.Runtime, &currMovie.Version)
+		err := rows.Scan(&totalRecord, &currMovie.ID, &currMovie.CreatedAt, &currMovie.CreatedBy, &currMovie.Title, pq.Array(&currMovie.Genres), &currMovie.Year, &currMovie.Runtime, (*Releases)(&currMovie.Releases), &currMovie.Status, &currMovie.Version)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -154,11 +165,38 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 type Movie struct {
 	ID        int64     `json:"id"`
 	CreatedAt time.Time `json:"-"`
+	CreatedBy *int64    `json:"created_by,omitempty"`
 	Title     string    `json:"title"`
 	Year      int32     `json:"year,omitzero"`
 	Runtime   Runtime   `json:"runtime,omitzero"`
 	Genres    []string  `json:"genres,omitempty"`
+	Releases  []Release `json:"releases,omitempty"`
+	Status    string    `json:"status"`
 	Version   int32     `json:"version"`
+
+	Collections   []*MovieCollection `json:"collections,omitempty"`
+	Relationships []*RelatedMovie    `json:"relationships,omitempty"`
+
+	RuntimeFormat RuntimeFormat `json:"-"`
+}
+
+// MarshalJSON renders the runtime in the format requested by the client,
+// keeping every other field as declared on Movie.
+func (m Movie) MarshalJSON() ([]byte, error) {
+
+	type movieJSON Movie
+
+	aux := struct {
+		movieJSON
+		Runtime any `json:"runtime,omitempty"`
+	}{movieJSON: movieJSON(m)}
+
+	if m.Runtime != 0 {
+		aux.Runtime = m.Runtime.Format(m.RuntimeFormat)
+	}
+
+	return json.Marshal(aux)
+
 }
 
 func ValidateMovie(v *validator.Validator, m *Movie) bool {
@@ -166,17 +204,31 @@ func ValidateMovie(v *validator.Validator, m *Movie) bool {
 	v.Check(m.Title != "", "title", "must be provided")
 	v.Check(len(m.Title) <= 500, "title", "must not be more than 500 bytes long")
 
+	ValidateStatus(v, "status", m.Status)
+
 	v.Check(m.Year != 0, "year", "must be provided")
-	v.Check(m.Year >= 1888 && m.Year <= int32(time.Now().Year()), "year", "must be greater than 1888 and not be in the future")
 
-	v.Check(m.Runtime != 0, "runtime", "must be provided")
-	v.Check(m.Runtime > 0, "runtime", "must be positive number")
+	// Only released movies are bound to the past; anything still being made
+	// may be scheduled up to 20 years ahead.
+	if IsUnreleased(m.Status) {
+		v.Check(m.Year >= 1888 && m.Year <= int32(time.Now().Year()+20), "year", "must be greater than 1888 and not more than 20 years in the future")
+	} else {
+		v.Check(m.Year >= 1888 && m.Year <= int32(time.Now().Year()), "year", "must be greater than 1888 and not be in the future")
+	}
+
+	// Runtime is usually unknown until a cut of the movie exists.
+	if m.Status == StatusReleased || m.Status == StatusPostProduction {
+		v.Check(m.Runtime != 0, "runtime", "must be provided")
+	}
+	v.Check(m.Runtime >= 0, "runtime", "must be positive number")
 
 	v.Check(m.Genres != nil, "genres", "must be provided")
 	v.Check(len(m.Genres) >= 1, "genres", "must contain at least 1 genre")
 	v.Check(len(m.Genres) <= 5, "genres", "must not contain more that 5 genres")
 	v.Check(validator.Unique(m.Genres), "genres", "must not contain duplicate values")
 
+	ValidateReleases(v, m.Releases)
+
 	return v.Valid()
 
 }
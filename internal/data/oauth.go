@@ -0,0 +1,417 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+	"github.com/lib/pq"
+)
+
+// OAuthTokenPrefix marks OAuth access tokens so the authenticate middleware
+// can route them without trying every token store.
+const OAuthTokenPrefix = "oat_"
+
+const oauthCodeTTL = 10 * time.Minute
+
+// CodeVerifierRX matches a PKCE code verifier as defined in RFC 7636.
+var CodeVerifierRX = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+type OAuthClient struct {
+	ID               string      `json:"client_id"`
+	CreatedAt        time.Time   `json:"created_at"`
+	Name             string      `json:"name"`
+	Secret           string      `json:"client_secret,omitempty"`
+	SecretHash       []byte      `json:"-"`
+	Confidential     bool        `json:"confidential"`
+	RedirectURIs     []string    `json:"redirect_uris"`
+	Scopes           Permissions `json:"scopes"`
+	ServiceAccountID *int64      `json:"service_account_id,omitempty"`
+}
+
+// Authenticate reports whether secret is the client's secret. Public
+// clients have no secret and never authenticate.
+func (c *OAuthClient) Authenticate(secret string) bool {
+
+	if !c.Confidential {
+		return false
+	}
+
+	hash := sha256.Sum256([]byte(secret))
+	return subtle.ConstantTimeCompare(hash[:], c.SecretHash) == 1
+
+}
+
+// AllowsClientCredentials reports whether the client can act on its own
+// behalf, which requires a secret and a service account to act as.
+func (c *OAuthClient) AllowsClientCredentials() bool {
+
+	return c.Confidential && c.ServiceAccountID != nil
+
+}
+
+func (c *OAuthClient) AllowsRedirectURI(uri string) bool {
+
+	return slices.Contains(c.RedirectURIs, uri)
+
+}
+
+type OAuthCode struct {
+	PlainText     string
+	ClientID      string
+	UserID        int64
+	RedirectURI   string
+	Scopes        Permissions
+	CodeChallenge string
+	Expiry        time.Time
+}
+
+// VerifyCodeChallenge checks a PKCE verifier against the S256 challenge the
+// code was issued with.
+func (c *OAuthCode) VerifyCodeChallenge(verifier string) bool {
+
+	hash := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(hash[:])
+
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(c.CodeChallenge)) == 1
+
+}
+
+type OAuthToken struct {
+	PlainText string
+	ClientID  string
+	UserID    int64
+	Scopes    Permissions
+	CreatedAt time.Time
+	Expiry    time.Time
+}
+
+type OAuthClientModel struct {
+	DB *sql.DB
+}
+
+// Insert registers a client, generating its ID and, for confidential
+// clients, a secret that is only available on the returned value.
+func (m OAuthClientModel) Insert(client *OAuthClient) error {
+
+	client.ID = strings.ToLower(rand.Text())
+
+	if client.Confidential {
+		client.Secret = rand.Text() + rand.Text()
+		hash := sha256.Sum256([]byte(client.Secret))
+		client.SecretHash = hash[:]
+	}
+
+	if client.RedirectURIs == nil {
+		client.RedirectURIs = []string{}
+	}
+
+	if client.Scopes == nil {
+		client.Scopes = Permissions{}
+	}
+
+	query := `
+	INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, scopes, service_account_id)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING created_at`
+
+	args := []any{client.ID, client.Name, client.SecretHash, pq.Array(client.RedirectURIs), pq.Array([]string(client.Scopes)), client.ServiceAccountID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&client.CreatedAt)
+
+}
+
+func (m OAuthClientModel) Get(id string) (*OAuthClient, error) {
+
+	query := `
+	SELECT id, created_at, name, secret_hash, redirect_uris, scopes, service_account_id
+	FROM oauth_clients WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var client OAuthClient
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&client.ID, &client.CreatedAt, &client.Name, &client.SecretHash, pq.Array(&client.RedirectURIs), pq.Array((*[]string)(&client.Scopes)), &client.ServiceAccountID)
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	client.Confidential = client.SecretHash != nil
+
+	return &client, nil
+
+}
+
+func (m OAuthClientModel) GetAll() ([]*OAuthClient, error) {
+
+	query := `
+	SELECT id, created_at, name, secret_hash IS NOT NULL, redirect_uris, scopes, service_account_id
+	FROM oauth_clients ORDER BY created_at, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	clients := []*OAuthClient{}
+
+	for rows.Next() {
+
+		var client OAuthClient
+
+		err := rows.Scan(&client.ID, &client.CreatedAt, &client.Name, &client.Confidential, pq.Array(&client.RedirectURIs), pq.Array((*[]string)(&client.Scopes)), &client.ServiceAccountID)
+		if err != nil {
+			return nil, err
+		}
+
+		clients = append(clients, &client)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return clients, nil
+
+}
+
+func (m OAuthClientModel) Delete(id string) error {
+
+	query := `DELETE FROM oauth_clients WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+
+}
+
+type OAuthCodeModel struct {
+	DB *sql.DB
+}
+
+func (m OAuthCodeModel) New(code *OAuthCode) error {
+
+	code.PlainText = rand.Text()
+	code.Expiry = time.Now().Add(oauthCodeTTL)
+
+	hash := sha256.Sum256([]byte(code.PlainText))
+
+	query := `
+	INSERT INTO oauth_authorization_codes (hash, client_id, user_id, redirect_uri, scopes, code_challenge, expiry)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	args := []any{hash[:], code.ClientID, code.UserID, code.RedirectURI, pq.Array([]string(code.Scopes)), code.CodeChallenge, code.Expiry}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+
+}
+
+// Consume looks up an unexpired code issued to clientID and deletes it, so
+// that each code can be exchanged at most once.
+func (m OAuthCodeModel) Consume(plainText, clientID string) (*OAuthCode, error) {
+
+	query := `
+	DELETE FROM oauth_authorization_codes
+	WHERE hash = $1 AND client_id = $2
+	RETURNING user_id, redirect_uri, scopes, code_challenge, expiry`
+
+	hash := sha256.Sum256([]byte(plainText))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	code := OAuthCode{PlainText: plainText, ClientID: clientID}
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:], clientID).Scan(&code.UserID, &code.RedirectURI, pq.Array((*[]string)(&code.Scopes)), &code.CodeChallenge, &code.Expiry)
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	if time.Now().After(code.Expiry) {
+		return nil, ErrRecordNotFound
+	}
+
+	return &code, nil
+
+}
+
+type OAuthTokenModel struct {
+	DB *sql.DB
+}
+
+func (m OAuthTokenModel) New(clientID string, userID int64, scopes Permissions, ttl time.Duration) (*OAuthToken, error) {
+
+	token := &OAuthToken{
+		PlainText: OAuthTokenPrefix + rand.Text(),
+		ClientID:  clientID,
+		UserID:    userID,
+		Scopes:    scopes,
+		Expiry:    time.Now().Add(ttl),
+	}
+
+	if token.Scopes == nil {
+		token.Scopes = Permissions{}
+	}
+
+	hash := sha256.Sum256([]byte(token.PlainText))
+
+	query := `
+	INSERT INTO oauth_tokens (hash, client_id, user_id, scopes, expiry)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:], clientID, userID, pq.Array([]string(token.Scopes)), token.Expiry).Scan(&token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+
+}
+
+// GetForToken looks up an unexpired access token along with the user it
+// was issued for.
+func (m OAuthTokenModel) GetForToken(plainText string) (*OAuthToken, *User, error) {
+
+	query := `
+	SELECT oauth_tokens.client_id, oauth_tokens.scopes, oauth_tokens.created_at, oauth_tokens.expiry,
+		users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.service_account,
+		EXISTS (SELECT 1 FROM user_totp WHERE user_totp.user_id = users.id AND user_totp.confirmed_at IS NOT NULL), users.version
+	FROM oauth_tokens
+	INNER JOIN users ON users.id = oauth_tokens.user_id
+	WHERE oauth_tokens.hash = $1 AND oauth_tokens.expiry > NOW() AND users.deactivated_at IS NULL`
+
+	hash := sha256.Sum256([]byte(plainText))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var (
+		token = OAuthToken{PlainText: plainText}
+		user  User
+	)
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:]).Scan(
+		&token.ClientID, pq.Array((*[]string)(&token.Scopes)), &token.CreatedAt, &token.Expiry,
+		&user.ID, &user.CreatedAt, &user.Name, &user.Email, &user.Password.hash, &user.Activated, &user.ServiceAccount, &user.TwoFactorEnabled, &user.Version,
+	)
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, ErrRecordNotFound
+		}
+		return nil, nil, err
+	}
+
+	token.UserID = user.ID
+
+	return &token, &user, nil
+
+}
+
+// Revoke deletes a token, but only if it was issued to clientID.
+func (m OAuthTokenModel) Revoke(plainText, clientID string) error {
+
+	query := `DELETE FROM oauth_tokens WHERE hash = $1 AND client_id = $2`
+
+	hash := sha256.Sum256([]byte(plainText))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, hash[:], clientID)
+	return err
+
+}
+
+// ParseScope splits a space-delimited OAuth scope parameter into permission
+// codes.
+func ParseScope(scope string) Permissions {
+
+	return Permissions(strings.Fields(scope))
+
+}
+
+// ValidateOAuthClient checks a client against the permissions of the user
+// registering it, who can't hand out more than they hold themselves.
+func ValidateOAuthClient(v *validator.Validator, client *OAuthClient, granterPermissions Permissions) {
+
+	v.Check(client.Name != "", "name", "must be provided")
+	v.Check(len(client.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(validator.Unique(client.Scopes), "scopes", "must not contain duplicate values")
+
+	for _, code := range client.Scopes {
+		v.Check(granterPermissions.Include(code), "scopes", "must only contain permissions you hold yourself")
+	}
+
+	v.Check(validator.Unique(client.RedirectURIs), "redirect_uris", "must not contain duplicate values")
+
+	for _, uri := range client.RedirectURIs {
+
+		u, err := url.Parse(uri)
+		v.Check(err == nil && u.IsAbs() && u.Fragment == "", "redirect_uris", "must only contain absolute URIs without a fragment")
+	}
+
+	if client.ServiceAccountID != nil {
+		v.Check(client.Confidential, "service_account_id", "can only be set for confidential clients")
+	}
+
+	v.Check(client.ServiceAccountID != nil || len(client.RedirectURIs) > 0, "redirect_uris", "must be provided unless the client uses a service account")
+
+}
+
+func ValidateCodeChallenge(v *validator.Validator, challenge, method string) {
+
+	v.Check(method == "S256", "code_challenge_method", "must be S256")
+	v.Check(len(challenge) == 43, "code_challenge", "must be a base64url encoded SHA-256 hash")
+
+}
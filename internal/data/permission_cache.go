@@ -0,0 +1,185 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PermissionsChangedChannel is the Postgres NOTIFY channel announcing grant
+// changes. The payload is a user ID, or "*" when any user may be affected.
+const PermissionsChangedChannel = "permissions_changed"
+
+const permissionCacheMaxEntries = 10_000
+
+type permissionCacheEntry struct {
+	permissions Permissions
+	expiry      time.Time
+}
+
+// PermissionCache keeps users' effective permissions in memory for a short
+// while. A nil *PermissionCache is valid and caches nothing.
+type PermissionCache struct {
+	ttl time.Duration
+
+	mu         sync.Mutex
+	entries    map[int64]permissionCacheEntry
+	generation uint64
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// NewPermissionCache returns nil, disabling caching, if ttl isn't positive.
+func NewPermissionCache(ttl time.Duration) *PermissionCache {
+
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &PermissionCache{ttl: ttl, entries: make(map[int64]permissionCacheEntry)}
+
+}
+
+// get returns the cached permissions for the user, if any, along with the
+// generation to pass to set after loading them from the database instead.
+func (c *PermissionCache) get(userID int64) (Permissions, uint64, bool) {
+
+	if c == nil {
+		return nil, 0, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[userID]
+	if ok && time.Now().Before(entry.expiry) {
+		c.hits.Add(1)
+		return slices.Clone(entry.permissions), c.generation, true
+	}
+
+	c.misses.Add(1)
+
+	return nil, c.generation, false
+
+}
+
+// set stores permissions loaded from the database, unless an invalidation
+// happened since generation was read, in which case they may be stale.
+func (c *PermissionCache) set(userID int64, permissions Permissions, generation uint64) {
+
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	now := time.Now()
+
+	if len(c.entries) >= permissionCacheMaxEntries {
+
+		for id, entry := range c.entries {
+			if now.After(entry.expiry) {
+				delete(c.entries, id)
+			}
+		}
+
+		if len(c.entries) >= permissionCacheMaxEntries {
+			clear(c.entries)
+		}
+	}
+
+	c.entries[userID] = permissionCacheEntry{permissions: slices.Clone(permissions), expiry: now.Add(c.ttl)}
+
+}
+
+func (c *PermissionCache) Invalidate(userID int64) {
+
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, userID)
+	c.generation++
+
+}
+
+func (c *PermissionCache) InvalidateAll() {
+
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.entries)
+	c.generation++
+
+}
+
+// HandleNotification applies a payload received on PermissionsChangedChannel.
+func (c *PermissionCache) HandleNotification(payload string) {
+
+	userID, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		c.InvalidateAll()
+		return
+	}
+
+	c.Invalidate(userID)
+
+}
+
+func (c *PermissionCache) Hits() int64 {
+
+	if c == nil {
+		return 0
+	}
+
+	return c.hits.Load()
+
+}
+
+func (c *PermissionCache) Misses() int64 {
+
+	if c == nil {
+		return 0
+	}
+
+	return c.misses.Load()
+
+}
+
+// permissionsChanged drops the user's cached permissions and tells other
+// API instances to do the same. A userID of 0 means every user.
+func permissionsChanged(db *sql.DB, cache *PermissionCache, userID int64) error {
+
+	payload := "*"
+
+	if userID == 0 {
+		cache.InvalidateAll()
+	} else {
+		cache.Invalidate(userID)
+		payload = strconv.FormatInt(userID, 10)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, PermissionsChangedChannel, payload)
+	return err
+
+}
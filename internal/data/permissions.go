@@ -5,6 +5,9 @@ import (
 	"database/sql"
 	"slices"
 	"time"
+
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+	"github.com/lib/pq"
 )
 
 type Permissions []string
@@ -14,18 +17,46 @@ func (p Permissions) Include(code string) bool {
 	return slices.Contains(p, code)
 }
 
+// Intersect returns the codes in p that are also in held.
+func (p Permissions) Intersect(held Permissions) Permissions {
+
+	result := Permissions{}
+
+	for _, code := range p {
+		if held.Include(code) {
+			result = append(result, code)
+		}
+	}
+
+	return result
+
+}
+
 type PermissionModel struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Cache *PermissionCache
 }
 
+// GetAllForUser returns the user's effective permissions: those granted
+// directly plus those that come with any of their roles.
 func (m *PermissionModel) GetAllForUser(userId int64) (Permissions, error) {
 
 	query := `
 	SELECT permissions.code
 	FROM permissions
 	INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-	INNER JOIN users ON users_permissions.user_id = users.id
-	WHERE users.id = $1`
+	WHERE users_permissions.user_id = $1
+	UNION
+	SELECT permissions.code
+	FROM permissions
+	INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+	INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+	WHERE users_roles.user_id = $1`
+
+	cached, generation, ok := m.Cache.get(userId)
+	if ok {
+		return cached, nil
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -55,6 +86,106 @@ func (m *PermissionModel) GetAllForUser(userId int64) (Permissions, error) {
 		return nil, err
 	}
 
+	m.Cache.set(userId, permissions, generation)
+
 	return permissions, nil
 
 }
+
+// GetAll returns every permission code that can be granted.
+func (m *PermissionModel) GetAll() (Permissions, error) {
+
+	query := `SELECT code FROM permissions ORDER BY code`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	permissions := Permissions{}
+
+	for rows.Next() {
+
+		var permission string
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+
+}
+
+// AddForUser grants codes to the user. Codes the user already holds are
+// left as they are.
+func (m *PermissionModel) AddForUser(userID int64, codes ...string) error {
+
+	query := `
+	INSERT INTO users_permissions (user_id, permission_id)
+	SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+	ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	if err != nil {
+		return err
+	}
+
+	return permissionsChanged(m.DB, m.Cache, userID)
+
+}
+
+func (m *PermissionModel) RemoveForUser(userID int64, code string) error {
+
+	query := `
+	DELETE FROM users_permissions
+	USING permissions
+	WHERE users_permissions.permission_id = permissions.id AND users_permissions.user_id = $1 AND permissions.code = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, userID, code)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return permissionsChanged(m.DB, m.Cache, userID)
+
+}
+
+// ValidatePermissionCodes checks codes being granted to a user. The granter
+// can't hand out more than they hold themselves.
+func ValidatePermissionCodes(v *validator.Validator, codes []string, known Permissions, granterPermissions Permissions) {
+
+	v.Check(len(codes) > 0, "permissions", "must contain at least 1 permission")
+	v.Check(validator.Unique(codes), "permissions", "must not contain duplicate values")
+
+	for _, code := range codes {
+		v.Check(known.Include(code), "permissions", "must only contain known permission codes")
+		v.Check(granterPermissions.Include(code), "permissions", "must only contain permissions you hold yourself")
+	}
+
+}
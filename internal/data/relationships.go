@@ -0,0 +1,213 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+)
+
+const (
+	RelationshipSequelOf  = "sequel_of"
+	RelationshipPrequelOf = "prequel_of"
+	RelationshipRemakeOf  = "remake_of"
+	RelationshipSpinoffOf = "spinoff_of"
+)
+
+var RelationshipTypes = []string{RelationshipSequelOf, RelationshipPrequelOf, RelationshipRemakeOf, RelationshipSpinoffOf}
+
+// inverseRelationshipTypes names a relationship from the point of view of
+// the related movie, e.g. if A is a sequel_of B then B is a prequel_of A.
+var inverseRelationshipTypes = map[string]string{
+	RelationshipSequelOf:  RelationshipPrequelOf,
+	RelationshipPrequelOf: RelationshipSequelOf,
+	RelationshipRemakeOf:  "remade_as",
+	RelationshipSpinoffOf: "has_spinoff",
+}
+
+var (
+	ErrRelationshipCycle     = errors.New("relationship cycle")
+	ErrDuplicateRelationship = errors.New("duplicate relationship")
+)
+
+// relationshipsLockID serialises writes to the sequel graph so that two
+// concurrent inserts can't each pass the cycle check and then close a loop.
+const relationshipsLockID = 7_265_001
+
+type Relationship struct {
+	ID             int64     `json:"id"`
+	CreatedAt      time.Time `json:"-"`
+	MovieID        int64     `json:"movie_id"`
+	Type           string    `json:"type"`
+	RelatedMovieID int64     `json:"related_movie_id"`
+}
+
+// RelatedMovie is a relationship as seen from one of its two movies.
+type RelatedMovie struct {
+	RelationshipID int64  `json:"relationship_id"`
+	Type           string `json:"type"`
+	ID             int64  `json:"id"`
+	Title          string `json:"title"`
+	Year           int32  `json:"year,omitzero"`
+	Status         string `json:"status"`
+}
+
+type RelationshipModel struct {
+	DB *sql.DB
+}
+
+func (m RelationshipModel) Insert(relationship *Relationship) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, relationshipsLockID)
+	if err != nil {
+		return err
+	}
+
+	if relationship.Type == RelationshipSequelOf || relationship.Type == RelationshipPrequelOf {
+
+		later, earlier := relationship.MovieID, relationship.RelatedMovieID
+		if relationship.Type == RelationshipPrequelOf {
+			later, earlier = earlier, later
+		}
+
+		// Adding "later follows earlier" closes a loop if earlier already
+		// follows later somewhere down the chain.
+		query := `
+		WITH RECURSIVE follows (later, earlier) AS (
+			SELECT movie_id, related_movie_id FROM movie_relationships WHERE type = 'sequel_of'
+			UNION ALL
+			SELECT related_movie_id, movie_id FROM movie_relationships WHERE type = 'prequel_of'
+		), chain (id) AS (
+			SELECT later FROM follows WHERE earlier = $1
+			UNION
+			SELECT follows.later FROM follows INNER JOIN chain ON follows.earlier = chain.id
+		)
+		SELECT EXISTS (SELECT 1 FROM chain WHERE id = $2)`
+
+		var cycle bool
+		err = tx.QueryRowContext(ctx, query, later, earlier).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+
+		if cycle {
+			return ErrRelationshipCycle
+		}
+	}
+
+	query := `INSERT INTO movie_relationships (movie_id, related_movie_id, type) VALUES ($1, $2, $3) RETURNING id, created_at`
+
+	err = tx.QueryRowContext(ctx, query, relationship.MovieID, relationship.RelatedMovieID, relationship.Type).Scan(&relationship.ID, &relationship.CreatedAt)
+	if err != nil {
+
+		switch {
+		case strings.Contains(err.Error(), "violates foreign key constraint"):
+			return ErrUnknownMovie
+		case strings.Contains(err.Error(), "violates unique constraint"):
+			return ErrDuplicateRelationship
+		}
+		return err
+	}
+
+	return tx.Commit()
+
+}
+
+// Delete removes a relationship that involves movieID on either side.
+func (m RelationshipModel) Delete(movieID, id int64) error {
+
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `DELETE FROM movie_relationships WHERE id = $1 AND (movie_id = $2 OR related_movie_id = $2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, id, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+
+}
+
+func (m RelationshipModel) GetAllForMovie(movieID int64) ([]*RelatedMovie, error) {
+
+	query := `
+	SELECT movie_relationships.id, movie_relationships.type, movie_relationships.movie_id = $1, movies.id, movies.title, movies.year, movies.status
+	FROM movie_relationships
+	INNER JOIN movies ON movies.id = CASE WHEN movie_relationships.movie_id = $1 THEN movie_relationships.related_movie_id ELSE movie_relationships.movie_id END
+	WHERE movie_relationships.movie_id = $1 OR movie_relationships.related_movie_id = $1
+	ORDER BY movies.year, movies.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	related := []*RelatedMovie{}
+
+	for rows.Next() {
+
+		var (
+			movie    RelatedMovie
+			outgoing bool
+		)
+
+		err := rows.Scan(&movie.RelationshipID, &movie.Type, &outgoing, &movie.ID, &movie.Title, &movie.Year, &movie.Status)
+		if err != nil {
+			return nil, err
+		}
+
+		if !outgoing {
+			movie.Type = inverseRelationshipTypes[movie.Type]
+		}
+
+		related = append(related, &movie)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return related, nil
+
+}
+
+func ValidateRelationship(v *validator.Validator, relationship *Relationship) {
+
+	v.Check(validator.PermittedValue(relationship.Type, RelationshipTypes...), "type", "must be one of sequel_of, prequel_of, remake_of or spinoff_of")
+	v.Check(relationship.RelatedMovieID > 0, "related_movie_id", "must be provided")
+	v.Check(relationship.RelatedMovieID != relationship.MovieID, "related_movie_id", "must not be the movie itself")
+
+}
@@ -0,0 +1,140 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+)
+
+const (
+	ReleaseTheatrical = "theatrical"
+	ReleaseDigital    = "digital"
+	ReleasePhysical   = "physical"
+)
+
+var ReleaseTypes = []string{ReleaseTheatrical, ReleaseDigital, ReleasePhysical}
+
+// Certifications lists the rating systems we accept per ISO 3166-1 alpha-2
+// country code, ordered from least to most restrictive.
+var Certifications = map[string][]string{
+	"AU": {"G", "PG", "M", "MA15+", "R18+", "X18+"},
+	"BR": {"L", "10", "12", "14", "16", "18"},
+	"CA": {"G", "PG", "14A", "18A", "R"},
+	"DE": {"FSK 0", "FSK 6", "FSK 12", "FSK 16", "FSK 18"},
+	"DK": {"A", "7", "11", "15"},
+	"ES": {"APTA", "7", "12", "16", "18", "X"},
+	"FI": {"S", "K-7", "K-12", "K-16", "K-18"},
+	"FR": {"U", "12", "16", "18"},
+	"GB": {"U", "PG", "12A", "12", "15", "18", "R18"},
+	"IE": {"G", "PG", "12A", "15A", "16", "18"},
+	"IN": {"U", "UA", "A", "S"},
+	"IT": {"T", "6+", "14+", "18+"},
+	"JP": {"G", "PG12", "R15+", "R18+"},
+	"KR": {"ALL", "12", "15", "18"},
+	"MX": {"AA", "A", "B", "B-15", "C", "D"},
+	"NL": {"AL", "6", "9", "12", "14", "16", "18"},
+	"NO": {"A", "6", "9", "12", "15", "18"},
+	"NZ": {"G", "PG", "M", "R13", "R15", "R16", "R18"},
+	"SE": {"Btl", "7", "11", "15"},
+	"US": {"G", "PG", "PG-13", "R", "NC-17"},
+}
+
+type Release struct {
+	Country       string `json:"country"`
+	Type          string `json:"type"`
+	Date          string `json:"date"`
+	Certification string `json:"certification,omitempty"`
+}
+
+type Releases []Release
+
+func (r Releases) Value() (driver.Value, error) {
+
+	if r == nil {
+		return []byte("[]"), nil
+	}
+
+	return json.Marshal(r)
+
+}
+
+func (r *Releases) Scan(src any) error {
+
+	var js []byte
+
+	switch v := src.(type) {
+	case []byte:
+		js = v
+	case string:
+		js = []byte(v)
+	case nil:
+		*r = nil
+		return nil
+	default:
+		return errors.New("unsupported type for releases column")
+	}
+
+	return json.Unmarshal(js, r)
+
+}
+
+type ReleaseFilter struct {
+	Country        string
+	Certifications []string
+	ReleasedIn     string
+}
+
+// CertificationsUpTo returns every certification in the country's system
+// that is no more restrictive than max.
+func CertificationsUpTo(country, max string) ([]string, bool) {
+
+	ratings, ok := Certifications[country]
+	if !ok {
+		return nil, false
+	}
+
+	i := slices.Index(ratings, max)
+	if i == -1 {
+		return nil, false
+	}
+
+	return ratings[:i+1], true
+
+}
+
+func ValidateCountry(v *validator.Validator, key string, country string) {
+
+	_, ok := Certifications[country]
+	v.Check(ok, key, "must be a supported ISO 3166-1 alpha-2 country code")
+
+}
+
+func ValidateReleases(v *validator.Validator, releases []Release) {
+
+	v.Check(len(releases) <= 100, "releases", "must not contain more than 100 entries")
+
+	seen := make(map[[2]string]bool)
+
+	for _, release := range releases {
+
+		ValidateCountry(v, "releases", release.Country)
+		v.Check(validator.PermittedValue(release.Type, ReleaseTypes...), "releases", "type must be one of theatrical, digital or physical")
+
+		_, err := time.Parse(time.DateOnly, release.Date)
+		v.Check(err == nil, "releases", "date must be in YYYY-MM-DD format")
+
+		if release.Certification != "" {
+			v.Check(validator.PermittedValue(release.Certification, Certifications[release.Country]...), "releases", "certification is not valid for "+release.Country)
+		}
+
+		key := [2]string{release.Country, release.Type}
+		v.Check(!seen[key], "releases", "must not contain more than one release per country and type")
+		seen[key] = true
+
+	}
+
+}
@@ -0,0 +1,334 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicateRole = errors.New("duplicate role")
+
+	RoleNameRX = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+)
+
+type Role struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"-"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Permissions Permissions `json:"permissions"`
+	Version     int32       `json:"version"`
+}
+
+type RoleModel struct {
+	DB    *sql.DB
+	Cache *PermissionCache
+}
+
+func (m RoleModel) Insert(role *Role) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	query := `INSERT INTO roles (name, description) VALUES ($1, $2) RETURNING id, created_at, version`
+
+	err = tx.QueryRowContext(ctx, query, role.Name, role.Description).Scan(&role.ID, &role.CreatedAt, &role.Version)
+	if err != nil {
+
+		if strings.Contains(err.Error(), `violates unique constraint "roles_name_key"`) {
+			return ErrDuplicateRole
+		}
+
+		return err
+	}
+
+	err = setRolePermissions(ctx, tx, role)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+
+}
+
+func (m RoleModel) Get(name string) (*Role, error) {
+
+	query := `
+	SELECT roles.id, roles.created_at, roles.name, roles.description, roles.version,
+		ARRAY(SELECT permissions.code FROM roles_permissions
+			INNER JOIN permissions ON permissions.id = roles_permissions.permission_id
+			WHERE roles_permissions.role_id = roles.id ORDER BY permissions.code)
+	FROM roles WHERE roles.name = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var role Role
+
+	err := m.DB.QueryRowContext(ctx, query, name).Scan(&role.ID, &role.CreatedAt, &role.Name, &role.Description, &role.Version, pq.Array((*[]string)(&role.Permissions)))
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &role, nil
+
+}
+
+func (m RoleModel) GetAll() ([]*Role, error) {
+
+	query := `
+	SELECT roles.id, roles.created_at, roles.name, roles.description, roles.version,
+		ARRAY(SELECT permissions.code FROM roles_permissions
+			INNER JOIN permissions ON permissions.id = roles_permissions.permission_id
+			WHERE roles_permissions.role_id = roles.id ORDER BY permissions.code)
+	FROM roles ORDER BY roles.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	roles := []*Role{}
+
+	for rows.Next() {
+
+		var role Role
+
+		err := rows.Scan(&role.ID, &role.CreatedAt, &role.Name, &role.Description, &role.Version, pq.Array((*[]string)(&role.Permissions)))
+		if err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, &role)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+
+}
+
+// Update saves the role's name and description and replaces its permission
+// set, so every holder of the role gains or loses codes at once.
+func (m RoleModel) Update(role *Role) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	query := `UPDATE roles SET name = $1, description = $2, version = version + 1
+	WHERE id = $3 AND version = $4
+	RETURNING version`
+
+	err = tx.QueryRowContext(ctx, query, role.Name, role.Description, role.ID, role.Version).Scan(&role.Version)
+	if err != nil {
+
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case strings.Contains(err.Error(), `violates unique constraint "roles_name_key"`):
+			return ErrDuplicateRole
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM roles_permissions WHERE role_id = $1`, role.ID)
+	if err != nil {
+		return err
+	}
+
+	err = setRolePermissions(ctx, tx, role)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return permissionsChanged(m.DB, m.Cache, 0)
+
+}
+
+func (m RoleModel) Delete(name string) error {
+
+	query := `DELETE FROM roles WHERE name = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return permissionsChanged(m.DB, m.Cache, 0)
+
+}
+
+// GetAllForUser returns the names of the roles the user holds.
+func (m RoleModel) GetAllForUser(userID int64) ([]string, error) {
+
+	query := `
+	SELECT roles.name FROM roles
+	INNER JOIN users_roles ON users_roles.role_id = roles.id
+	WHERE users_roles.user_id = $1
+	ORDER BY roles.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	roles := []string{}
+
+	for rows.Next() {
+
+		var role string
+
+		err := rows.Scan(&role)
+		if err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, role)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+
+}
+
+// AddForUser assigns the named roles to the user. Roles the user already
+// holds are left as they are.
+func (m RoleModel) AddForUser(userID int64, names ...string) error {
+
+	query := `
+	INSERT INTO users_roles (user_id, role_id)
+	SELECT $1, roles.id FROM roles WHERE roles.name = ANY($2)
+	ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(names))
+	if err != nil {
+		return err
+	}
+
+	return permissionsChanged(m.DB, m.Cache, userID)
+
+}
+
+func (m RoleModel) RemoveForUser(userID int64, name string) error {
+
+	query := `
+	DELETE FROM users_roles
+	USING roles
+	WHERE users_roles.role_id = roles.id AND users_roles.user_id = $1 AND roles.name = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, userID, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return permissionsChanged(m.DB, m.Cache, userID)
+
+}
+
+func setRolePermissions(ctx context.Context, tx *sql.Tx, role *Role) error {
+
+	query := `
+	INSERT INTO roles_permissions (role_id, permission_id)
+	SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+
+	_, err := tx.ExecContext(ctx, query, role.ID, pq.Array([]string(role.Permissions)))
+	return err
+
+}
+
+// ValidateRole checks a role against the permissions of the user defining
+// it, who can't bundle up more than they hold themselves.
+func ValidateRole(v *validator.Validator, role *Role, known Permissions, granterPermissions Permissions) {
+
+	v.Check(role.Name != "", "name", "must be provided")
+	v.Check(len(role.Name) <= 50, "name", "must not be more than 50 bytes long")
+	v.Check(validator.Matches(role.Name, RoleNameRX), "name", "must only contain lowercase letters, digits and hyphens")
+	v.Check(len(role.Description) <= 500, "description", "must not be more than 500 bytes long")
+	v.Check(validator.Unique(role.Permissions), "permissions", "must not contain duplicate values")
+
+	for _, code := range role.Permissions {
+		v.Check(known.Include(code), "permissions", "must only contain known permission codes")
+		v.Check(granterPermissions.Include(code), "permissions", "must only contain permissions you hold yourself")
+	}
+
+}
+
+func ValidateRoleNames(v *validator.Validator, names []string) {
+
+	v.Check(len(names) > 0, "roles", "must contain at least 1 role")
+	v.Check(validator.Unique(names), "roles", "must not contain duplicate values")
+
+}
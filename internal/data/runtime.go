@@ -3,12 +3,30 @@ package data
 import (
 	"errors"
 	"fmt"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
 )
 
 var ErrInvalidRuntimeFormat = errors.New(`invalid format for 'runtime' property`)
 
+type RuntimeFormat string
+
+const (
+	RuntimeFormatMinutes RuntimeFormat = "minutes"
+	RuntimeFormatMins    RuntimeFormat = "mins"
+	RuntimeFormatISO8601 RuntimeFormat = "iso8601"
+	RuntimeFormatHuman   RuntimeFormat = "human"
+)
+
+var RuntimeFormats = []RuntimeFormat{RuntimeFormatMinutes, RuntimeFormatMins, RuntimeFormatISO8601, RuntimeFormatHuman}
+
+var (
+	iso8601RuntimeRX = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+	humanRuntimeRX   = regexp.MustCompile(`^(?:(\d+)\s*h(?:ours?|rs?)?)?\s*(?:(\d+)\s*m(?:in(?:ute)?s?)?)?$`)
+)
+
 type Runtime int32
 
 func (r Runtime) MarshalJSON() ([]byte, error) {
@@ -20,21 +38,151 @@ func (r Runtime) MarshalJSON() ([]byte, error) {
 
 func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
 
-	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
-	if err != nil {
-		return ErrInvalidRuntimeFormat
+	value := string(jsonValue)
+	if value == "null" {
+		return nil
 	}
 
-	parts := strings.Split(unquotedJSONValue, " ")
-	if len(parts) != 2 || parts[1] != "mins" {
-		return ErrInvalidRuntimeFormat
+	if !strings.HasPrefix(value, `"`) {
+
+		minutes, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("%w: a numeric runtime must be a whole number of minutes", ErrInvalidRuntimeFormat)
+		}
+
+		*r = Runtime(minutes)
+		return nil
 	}
 
-	i, err := strconv.ParseInt(parts[0], 10, 32)
+	unquotedJSONValue, err := strconv.Unquote(value)
 	if err != nil {
 		return ErrInvalidRuntimeFormat
 	}
 
-	*r = Runtime(i)
+	runtime, err := ParseRuntime(unquotedJSONValue)
+	if err != nil {
+		return err
+	}
+
+	*r = runtime
 	return nil
 }
+
+// ParseRuntime accepts a plain number of minutes ("102"), the legacy
+// "102 mins" form, hours and minutes ("1h 42m") and ISO 8601 durations
+// ("PT1H42M").
+func ParseRuntime(s string) (Runtime, error) {
+
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("%w: must not be empty", ErrInvalidRuntimeFormat)
+	}
+
+	if strings.HasPrefix(s, "P") {
+		return parseISO8601Runtime(s)
+	}
+
+	if minutes, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return runtimeFromMinutes(minutes)
+	}
+
+	matches := humanRuntimeRX.FindStringSubmatch(strings.ToLower(s))
+	if matches == nil || (matches[1] == "" && matches[2] == "") {
+		return 0, fmt.Errorf(`%w: %q is not recognised, use minutes (102), "102 mins", "1h 42m" or ISO 8601 ("PT1H42M")`, ErrInvalidRuntimeFormat, s)
+	}
+
+	hours, err := parseRuntimePart(s, matches[1])
+	if err != nil {
+		return 0, err
+	}
+
+	minutes, err := parseRuntimePart(s, matches[2])
+	if err != nil {
+		return 0, err
+	}
+
+	return runtimeFromMinutes(hours*60 + minutes)
+
+}
+
+func parseISO8601Runtime(s string) (Runtime, error) {
+
+	matches := iso8601RuntimeRX.FindStringSubmatch(s)
+	if matches == nil || s == "P" || strings.HasSuffix(s, "T") {
+		return 0, fmt.Errorf("%w: %q is not a valid ISO 8601 duration, years and months are not supported", ErrInvalidRuntimeFormat, s)
+	}
+
+	var parts [4]int64
+	for i, match := range matches[1:] {
+
+		n, err := parseRuntimePart(s, match)
+		if err != nil {
+			return 0, err
+		}
+		parts[i] = n
+	}
+
+	days, hours, minutes, seconds := parts[0], parts[1], parts[2], parts[3]
+	if seconds%60 != 0 {
+		return 0, fmt.Errorf("%w: %q must be a whole number of minutes", ErrInvalidRuntimeFormat, s)
+	}
+
+	return runtimeFromMinutes(days*24*60 + hours*60 + minutes + seconds/60)
+
+}
+
+func parseRuntimePart(s, part string) (int64, error) {
+
+	if part == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(part, 10, 64)
+	if err != nil || n > math.MaxInt32 {
+		return 0, fmt.Errorf("%w: %q is too large", ErrInvalidRuntimeFormat, s)
+	}
+
+	return n, nil
+
+}
+
+func runtimeFromMinutes(minutes int64) (Runtime, error) {
+
+	if minutes > math.MaxInt32 || minutes < math.MinInt32 {
+		return 0, fmt.Errorf("%w: value is too large", ErrInvalidRuntimeFormat)
+	}
+
+	return Runtime(minutes), nil
+
+}
+
+// Format returns the runtime as a JSON-encodable value in the given format.
+// Unknown formats fall back to the legacy "<n> mins" string.
+func (r Runtime) Format(format RuntimeFormat) any {
+
+	hours, minutes := r/60, r%60
+
+	switch format {
+	case RuntimeFormatMinutes:
+		return int32(r)
+	case RuntimeFormatISO8601:
+		switch {
+		case hours == 0:
+			return fmt.Sprintf("PT%dM", minutes)
+		case minutes == 0:
+			return fmt.Sprintf("PT%dH", hours)
+		}
+		return fmt.Sprintf("PT%dH%dM", hours, minutes)
+	case RuntimeFormatHuman:
+		switch {
+		case hours == 0:
+			return fmt.Sprintf("%dm", minutes)
+		case minutes == 0:
+			return fmt.Sprintf("%dh", hours)
+		}
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+
+	return fmt.Sprintf("%d mins", r)
+
+}
@@ -0,0 +1,50 @@
+package data
+
+import (
+	"slices"
+
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+)
+
+const (
+	StatusAnnounced      = "announced"
+	StatusInProduction   = "in_production"
+	StatusPostProduction = "post_production"
+	StatusReleased       = "released"
+	StatusCancelled      = "cancelled"
+)
+
+var Statuses = []string{StatusAnnounced, StatusInProduction, StatusPostProduction, StatusReleased, StatusCancelled}
+
+// statusTransitions lists the statuses a movie may move to from each status.
+// Production stages may be skipped when a movie is catalogued late, and a
+// cancelled movie can be revived by announcing it again.
+var statusTransitions = map[string][]string{
+	StatusAnnounced:      {StatusInProduction, StatusPostProduction, StatusReleased, StatusCancelled},
+	StatusInProduction:   {StatusPostProduction, StatusReleased, StatusCancelled},
+	StatusPostProduction: {StatusReleased, StatusCancelled},
+	StatusReleased:       {},
+	StatusCancelled:      {StatusAnnounced},
+}
+
+func IsUnreleased(status string) bool {
+
+	return status != StatusReleased
+
+}
+
+func ValidateStatus(v *validator.Validator, key string, status string) {
+
+	v.Check(validator.PermittedValue(status, Statuses...), key, "must be one of announced, in_production, post_production, released or cancelled")
+
+}
+
+func ValidateStatusTransition(v *validator.Validator, from, to string) {
+
+	if from == to || !slices.Contains(Statuses, to) {
+		return
+	}
+
+	v.Check(slices.Contains(statusTransitions[from], to), "status", "cannot change from "+from+" to "+to)
+
+}
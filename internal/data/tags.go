@@ -0,0 +1,293 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+)
+
+var TagRX = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+type Tag struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	MovieCount int    `json:"movie_count"`
+	Votes      int    `json:"votes"`
+}
+
+type MovieTag struct {
+	Name      string    `json:"name"`
+	Votes     int       `json:"votes"`
+	AddedBy   *int64    `json:"added_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type TagModel struct {
+	DB *sql.DB
+}
+
+// Attach adds a tag to a movie on behalf of userID, creating the tag if it
+// is new, and records the user's vote for it. Tagging a movie that already
+// carries the tag just counts as another vote.
+func (m TagModel) Attach(movieID int64, name string, userID int64) (*MovieTag, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var tagID int64
+
+	query := `INSERT INTO tags (name) VALUES ($1)
+	ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+	RETURNING id`
+
+	err = tx.QueryRowContext(ctx, query, name).Scan(&tagID)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `INSERT INTO movies_tags (movie_id, tag_id, added_by) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+
+	_, err = tx.ExecContext(ctx, query, movieID, tagID, userID)
+	if err != nil {
+
+		if strings.Contains(err.Error(), "violates foreign key constraint") {
+			return nil, ErrUnknownMovie
+		}
+		return nil, err
+	}
+
+	query = `INSERT INTO movies_tags_votes (movie_id, tag_id, user_id) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+
+	_, err = tx.ExecContext(ctx, query, movieID, tagID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := MovieTag{Name: name}
+
+	query = `SELECT movies_tags.added_by, movies_tags.created_at, (SELECT count(*) FROM movies_tags_votes WHERE movie_id = $1 AND tag_id = $2)
+	FROM movies_tags WHERE movie_id = $1 AND tag_id = $2`
+
+	err = tx.QueryRowContext(ctx, query, movieID, tagID).Scan(&tag.AddedBy, &tag.CreatedAt, &tag.Votes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tag, tx.Commit()
+
+}
+
+// RemoveVote withdraws a user's vote for a tag on a movie. Once nobody is
+// voting for it any more the tag is taken off the movie.
+func (m TagModel) RemoveVote(movieID int64, name string, userID int64) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	query := `DELETE FROM movies_tags_votes
+	USING tags
+	WHERE tags.id = movies_tags_votes.tag_id AND movies_tags_votes.movie_id = $1 AND tags.name = $2 AND movies_tags_votes.user_id = $3`
+
+	res, err := tx.ExecContext(ctx, query, movieID, name, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	query = `DELETE FROM movies_tags
+	USING tags
+	WHERE tags.id = movies_tags.tag_id AND movies_tags.movie_id = $1 AND tags.name = $2
+	AND NOT EXISTS (SELECT 1 FROM movies_tags_votes WHERE movies_tags_votes.movie_id = movies_tags.movie_id AND movies_tags_votes.tag_id = movies_tags.tag_id)`
+
+	_, err = tx.ExecContext(ctx, query, movieID, name)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+
+}
+
+func (m TagModel) Detach(movieID int64, name string) error {
+
+	query := `DELETE FROM movies_tags USING tags WHERE tags.id = movies_tags.tag_id AND movies_tags.movie_id = $1 AND tags.name = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, movieID, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+
+}
+
+func (m TagModel) Delete(name string) error {
+
+	query := `DELETE FROM tags WHERE name = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+
+}
+
+func (m TagModel) GetAllForMovie(movieID int64) ([]*MovieTag, error) {
+
+	query := `SELECT tags.name, movies_tags.added_by, movies_tags.created_at, count(movies_tags_votes.user_id)
+	FROM movies_tags
+	INNER JOIN tags ON tags.id = movies_tags.tag_id
+	LEFT JOIN movies_tags_votes ON movies_tags_votes.movie_id = movies_tags.movie_id AND movies_tags_votes.tag_id = movies_tags.tag_id
+	WHERE movies_tags.movie_id = $1
+	GROUP BY tags.name, movies_tags.added_by, movies_tags.created_at
+	ORDER BY count(movies_tags_votes.user_id) DESC, tags.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tags := []*MovieTag{}
+
+	for rows.Next() {
+
+		var tag MovieTag
+
+		err := rows.Scan(&tag.Name, &tag.AddedBy, &tag.CreatedAt, &tag.Votes)
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, &tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+
+}
+
+// GetAll lists tags that are attached to at least one movie, along with how
+// many movies carry them and how many votes they have in total.
+func (m TagModel) GetAll(name string, filters Filters) ([]*Tag, Metadata, error) {
+
+	query := fmt.Sprintf(`SELECT count(*) OVER(), id, name, movie_count, votes
+	FROM (
+		SELECT tags.id, tags.name,
+			count(DISTINCT movies_tags.movie_id) AS movie_count,
+			count(movies_tags_votes.user_id) AS votes
+		FROM tags
+		INNER JOIN movies_tags ON movies_tags.tag_id = tags.id
+		LEFT JOIN movies_tags_votes ON movies_tags_votes.movie_id = movies_tags.movie_id AND movies_tags_votes.tag_id = movies_tags.tag_id
+		WHERE (tags.name LIKE $1 || '%%' OR $1 = '')
+		GROUP BY tags.id, tags.name
+	) AS tag_counts
+	ORDER BY %s %s, id ASC
+	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	tags := []*Tag{}
+
+	for rows.Next() {
+
+		var tag Tag
+
+		err := rows.Scan(&totalRecords, &tag.ID, &tag.Name, &tag.MovieCount, &tag.Votes)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		tags = append(tags, &tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return tags, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+
+}
+
+func NormalizeTag(name string) string {
+
+	return strings.ToLower(strings.TrimSpace(name))
+
+}
+
+func ValidateTag(v *validator.Validator, key string, name string) {
+
+	v.Check(name != "", key, "must be provided")
+	v.Check(len(name) <= 50, key, "must not be more than 50 bytes long")
+	v.Check(validator.Matches(name, TagRX), key, "must only contain lowercase letters, digits and single hyphens")
+
+}
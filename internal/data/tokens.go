@@ -5,22 +5,64 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/ishowdarkside/go-movies-app/internal/validator"
+	"github.com/lib/pq"
 )
 
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
+	ScopeEmailChange    = "email-change"
+	ScopeRefresh        = "refresh"
+	ScopeMFAPending     = "mfa-pending"
+	ScopeMagicLink      = "magic-link"
+	ScopeAccountUnlock  = "account-unlock"
+	ScopeAccountRestore = "account-restore"
 )
 
+// sessionScopes are the scopes that make up a signed-in session: the
+// short-lived access token and the refresh token that renews it.
+var sessionScopes = []string{ScopeAuthentication, ScopeRefresh}
+
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
 type Token struct {
 	PlainText string    `json:"token"`
 	Hash      []byte    `json:"-"`
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	SessionID string    `json:"session_id"`
+	IP        string    `json:"-"`
+	UserAgent string    `json:"-"`
+}
+
+// Session describes a signed-in authentication token without exposing the
+// token itself. Its ID is random and unrelated to the token hash.
+type Session struct {
+	ID         string     `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Expiry     time.Time  `json:"expiry"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	Current    bool       `json:"current"`
+}
+
+func NewSessionID() string {
+
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) *Token {
@@ -31,6 +73,7 @@ func generateToken(userID int64, ttl time.Duration, scope string) *Token {
 		UserID:    userID,
 		Expiry:    time.Now().Add(ttl),
 		Scope:     scope,
+		SessionID: NewSessionID(),
 	}
 
 	hash := sha256.Sum256([]byte(token.PlainText))
@@ -53,13 +96,13 @@ type TokenModel struct {
 func (m *TokenModel) Insert(token *Token) error {
 
 	query := `
-	INSERT INTO tokens (hash, user_id, expiry, scope) 
-	VALUES ($1, $2, $3, $4)`
+	INSERT INTO tokens (hash, user_id, expiry, scope, session_id, ip, user_agent) 
+	VALUES ($1, $2, $3, $4, $5, $6, $7)`
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, token.Hash, token.UserID, token.Expiry, token.Scope)
+	_, err := m.DB.ExecContext(ctx, query, token.Hash, token.UserID, token.Expiry, token.Scope, token.SessionID, token.IP, truncate(token.UserAgent, 512))
 	return err
 
 }
@@ -73,6 +116,208 @@ func (m *TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 
 }
 
+// NewForSession creates a token that records the client it was issued to,
+// so it can be listed and revoked as part of a session.
+func (m *TokenModel) NewForSession(sessionID string, userID int64, ttl time.Duration, scope, ip, userAgent string) (*Token, error) {
+
+	token := generateToken(userID, ttl, scope)
+	token.SessionID = sessionID
+	token.IP = ip
+	token.UserAgent = userAgent
+
+	err := m.Insert(token)
+
+	return token, err
+
+}
+
+// UseRefreshToken consumes a refresh token and retires the access tokens of
+// its session, returning the session so that fresh tokens can be issued.
+// Used refresh tokens are kept until they expire: presenting one again means
+// it has leaked, so the whole session is revoked and ErrRefreshTokenReused
+// is returned.
+func (m *TokenModel) UseRefreshToken(tokenPlainText string) (*Token, error) {
+
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	token := Token{Hash: tokenHash[:], Scope: ScopeRefresh}
+
+	query := `
+	UPDATE tokens SET used_at = NOW()
+	WHERE hash = $1 AND scope = $2 AND expiry > NOW() AND used_at IS NULL
+	RETURNING user_id, session_id, expiry`
+
+	err = tx.QueryRowContext(ctx, query, token.Hash, ScopeRefresh).Scan(&token.UserID, &token.SessionID, &token.Expiry)
+	if err != nil {
+
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		query = `SELECT session_id FROM tokens WHERE hash = $1 AND scope = $2 AND used_at IS NOT NULL`
+
+		err = tx.QueryRowContext(ctx, query, token.Hash, ScopeRefresh).Scan(&token.SessionID)
+		if err != nil {
+
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrRecordNotFound
+			}
+			return nil, err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE session_id = $1 AND scope = ANY($2)`, token.SessionID, pq.Array(sessionScopes))
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, ErrRefreshTokenReused
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE session_id = $1 AND scope = $2`, token.SessionID, ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, tx.Commit()
+
+}
+
+// Touch records that a token has just been used and returns the session it
+// belongs to. To keep authenticated requests cheap the row is only rewritten
+// once a minute unless the client details change.
+func (m *TokenModel) Touch(tokenPlainText, ip, userAgent string) (string, error) {
+
+	query := `
+	WITH touched AS (
+		UPDATE tokens SET last_used_at = NOW(), ip = $2, user_agent = $3
+		WHERE hash = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute' OR ip <> $2 OR user_agent <> $3)
+	)
+	SELECT session_id FROM tokens WHERE hash = $1`
+
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+	userAgent = truncate(userAgent, 512)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	var sessionID string
+
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], ip, userAgent).Scan(&sessionID)
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrRecordNotFound
+		}
+		return "", err
+	}
+
+	return sessionID, nil
+
+}
+
+func (m *TokenModel) GetSessionsForUser(userID int64, currentSessionID string) ([]*Session, error) {
+
+	query := `
+	SELECT session_id, min(created_at), max(last_used_at), max(expiry),
+		(array_agg(ip ORDER BY last_used_at DESC NULLS LAST, created_at DESC))[1],
+		(array_agg(user_agent ORDER BY last_used_at DESC NULLS LAST, created_at DESC))[1],
+		session_id = $3
+	FROM tokens
+	WHERE user_id = $1 AND scope = ANY($2) AND expiry > NOW()
+	GROUP BY session_id
+	ORDER BY max(last_used_at) DESC NULLS LAST, min(created_at) DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, pq.Array(sessionScopes), currentSessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	sessions := []*Session{}
+
+	for rows.Next() {
+
+		var session Session
+
+		err := rows.Scan(&session.ID, &session.CreatedAt, &session.LastUsedAt, &session.Expiry, &session.IP, &session.UserAgent, &session.Current)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, &session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+
+}
+
+func (m *TokenModel) DeleteSession(userID int64, sessionID string) error {
+
+	query := `
+	DELETE FROM tokens WHERE user_id = $1 AND session_id = $2 AND scope = ANY($3)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, userID, sessionID, pq.Array(sessionScopes))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+
+}
+
+// truncate cuts client-supplied header values down to at most n bytes of
+// valid UTF-8 so they can be stored safely.
+func truncate(s string, n int) string {
+
+	s = strings.ToValidUTF8(s, "")
+
+	if len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+
+}
+
 func (m *TokenModel) DeleteAllForUser(scope string, userID int64) error {
 
 	query := `
@@ -85,3 +330,34 @@ func (m *TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	return err
 
 }
+
+func (m *TokenModel) DeleteExpired() (int64, error) {
+
+	query := `DELETE FROM tokens WHERE expiry < NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+
+}
+
+// DeleteSessionsForUser signs the user out everywhere apart from the
+// keepSessionID session. Pass an empty string to revoke every session.
+func (m *TokenModel) DeleteSessionsForUser(userID int64, keepSessionID string) error {
+
+	query := `
+	DELETE FROM tokens WHERE scope = ANY($1) AND user_id = $2 AND session_id <> $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, pq.Array(sessionScopes), userID, keepSessionID)
+	return err
+
+}
@@ -0,0 +1,229 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ishowdarkside/go-movies-app/internal/totp"
+	"github.com/ishowdarkside/go-movies-app/internal/validator"
+)
+
+const recoveryCodeCount = 10
+
+var ErrTwoFactorEnabled = errors.New("two-factor authentication already enabled")
+
+type TwoFactor struct {
+	UserID      int64
+	Secret      string
+	ConfirmedAt *time.Time
+	LastCounter int64
+}
+
+type TwoFactorModel struct {
+	DB *sql.DB
+}
+
+// Enrol stores a new, unconfirmed TOTP secret for the user, replacing any
+// earlier enrolment that was never confirmed.
+func (m TwoFactorModel) Enrol(userID int64) (*TwoFactor, error) {
+
+	tf := &TwoFactor{UserID: userID, Secret: totp.GenerateSecret()}
+
+	query := `
+	INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = NOW(), last_counter = 0
+	WHERE user_totp.confirmed_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, tf.UserID, tf.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	return tf, nil
+
+}
+
+func (m TwoFactorModel) Get(userID int64) (*TwoFactor, error) {
+
+	query := `SELECT user_id, secret, confirmed_at, last_counter FROM user_totp WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var tf TwoFactor
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&tf.UserID, &tf.Secret, &tf.ConfirmedAt, &tf.LastCounter)
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &tf, nil
+
+}
+
+// UseCounter records that the code for a time step has been accepted,
+// confirming the enrolment if needed. It returns ErrRecordNotFound if that
+// step, or a later one, was already used.
+func (m TwoFactorModel) UseCounter(userID, counter int64) error {
+
+	query := `
+	UPDATE user_totp SET last_counter = $2, confirmed_at = COALESCE(confirmed_at, NOW())
+	WHERE user_id = $1 AND last_counter < $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, userID, counter)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+
+}
+
+// Delete turns two-factor authentication off and discards the recovery
+// codes.
+func (m TwoFactorModel) Delete(userID int64) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+
+}
+
+// NewRecoveryCodes replaces the user's recovery codes with a fresh set. The
+// plaintext codes are only available on the returned value.
+func (m TwoFactorModel) NewRecoveryCodes(userID int64) ([]string, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+
+		text := strings.ToLower(rand.Text())
+		codes[i] = text[:5] + "-" + text[5:10]
+
+		hash := sha256.Sum256([]byte(codes[i]))
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO user_recovery_codes (user_id, hash) VALUES ($1, $2)`, userID, hash[:])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, tx.Commit()
+
+}
+
+// UseRecoveryCode consumes one of the user's recovery codes, returning
+// ErrRecordNotFound if it doesn't match an unused code.
+func (m TwoFactorModel) UseRecoveryCode(userID int64, code string) error {
+
+	query := `DELETE FROM user_recovery_codes WHERE user_id = $1 AND hash = $2`
+
+	hash := sha256.Sum256([]byte(NormalizeRecoveryCode(code)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, userID, hash[:])
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+
+}
+
+func NormalizeRecoveryCode(code string) string {
+
+	return strings.ToLower(strings.TrimSpace(code))
+
+}
+
+// IsRecoveryCode tells recovery codes apart from TOTP codes, which are all
+// digits.
+func IsRecoveryCode(code string) bool {
+
+	return strings.Contains(code, "-")
+
+}
+
+func ValidateTwoFactorCode(v *validator.Validator, code string) {
+
+	v.Check(code != "", "code", "must be provided")
+	v.Check(len(code) <= 20, "code", "must not be more than 20 bytes long")
+
+}
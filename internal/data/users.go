@@ -2,14 +2,18 @@ package data
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/ishowdarkside/go-movies-app/internal/passhash"
 	"github.com/ishowdarkside/go-movies-app/internal/validator"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/lib/pq"
 )
 
 var (
@@ -24,15 +28,16 @@ func (m *UserModel) GetForToken(scope string, tokenPlainText string) (*User, err
 
 	var user User
 
-	query := `SELECT users.id, users.created_at, users.name, users.password_hash, users.activated, users.email, users.version FROM USERS
-	INNER JOIN tokens ON users.id = tokens.user_id WHERE tokens.scope = $1 AND tokens.hash = $2 and tokens.expiry > $3`
+	query := `SELECT users.id, users.created_at, users.name, users.password_hash, users.activated, users.email, users.service_account, users.deactivated_at IS NOT NULL, EXISTS (SELECT 1 FROM user_totp WHERE user_totp.user_id = users.id AND user_totp.confirmed_at IS NOT NULL), users.version FROM USERS
+	INNER JOIN tokens ON users.id = tokens.user_id WHERE tokens.scope = $1 AND tokens.hash = $2 and tokens.expiry > $3
+	AND (users.deleted_at IS NULL OR tokens.scope = $4)`
 
 	tokenHash := sha256.Sum256([]byte(tokenPlainText))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, scope, tokenHash[:], time.Now()).Scan(&user.ID, &user.CreatedAt, &user.Name, &user.Password.hash, &user.Activated, &user.Email, &user.Version)
+	err := m.DB.QueryRowContext(ctx, query, scope, tokenHash[:], time.Now(), ScopeAccountRestore).Scan(&user.ID, &user.CreatedAt, &user.Name, &user.Password.hash, &user.Activated, &user.Email, &user.ServiceAccount, &user.Deactivated, &user.TwoFactorEnabled, &user.Version)
 
 	if err != nil {
 
@@ -47,15 +52,42 @@ func (m *UserModel) GetForToken(scope string, tokenPlainText string) (*User, err
 
 }
 
+// GetForSession returns the user a signed access token was issued to, as
+// long as the session it belongs to hasn't been signed out or revoked.
+func (m *UserModel) GetForSession(sessionID string, userID int64) (*User, error) {
+
+	var user User
+
+	query := `SELECT users.id, users.created_at, users.name, users.password_hash, users.activated, users.email, users.service_account, users.deactivated_at IS NOT NULL, EXISTS (SELECT 1 FROM user_totp WHERE user_totp.user_id = users.id AND user_totp.confirmed_at IS NOT NULL), users.version FROM users
+	WHERE users.id = $1 AND users.deleted_at IS NULL
+	AND EXISTS (SELECT 1 FROM tokens WHERE tokens.user_id = users.id AND tokens.session_id = $2 AND tokens.scope = ANY($3) AND tokens.expiry > NOW())`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, sessionID, pq.Array(sessionScopes)).Scan(&user.ID, &user.CreatedAt, &user.Name, &user.Password.hash, &user.Activated, &user.Email, &user.ServiceAccount, &user.Deactivated, &user.TwoFactorEnabled, &user.Version)
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+
+}
+
 func (m *UserModel) Insert(user *User) error {
 
-	query := `INSERT INTO users (name, email, password_hash, activated) VALUES ($1, $2, $3, $4) RETURNING id, created_at, version`
+	query := `INSERT INTO users (name, email, password_hash, activated, activated_at, service_account)
+	VALUES ($1, $2, $3, $4, CASE WHEN $4 THEN NOW() END, $5) RETURNING id, created_at, version`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, user.Name, user.Email, user.Password.hash, user.Activated).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	err := m.DB.QueryRowContext(ctx, query, user.Name, user.Email, user.Password.hash, user.Activated, user.ServiceAccount).Scan(&user.ID, &user.CreatedAt, &user.Version)
 	if err != nil {
 
 		if strings.Contains(err.Error(), `violates unique constraint "users_email_key"`) {
@@ -72,11 +104,11 @@ func (m *UserModel) GetByEmail(email string) (*User, error) {
 
 	input := User{}
 
-	query := `SELECT id, created_at, name, email, password_hash, activated, version FROM users WHERE email = $1`
+	query := `SELECT id, created_at, name, email, password_hash, activated, service_account, deactivated_at IS NOT NULL, EXISTS (SELECT 1 FROM user_totp WHERE user_totp.user_id = users.id AND user_totp.confirmed_at IS NOT NULL), version FROM users WHERE email = $1 AND deleted_at IS NULL`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, email).Scan(&input.ID, &input.CreatedAt, &input.Name, &input.Email, &input.Password.hash, &input.Activated, &input.Version)
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(&input.ID, &input.CreatedAt, &input.Name, &input.Email, &input.Password.hash, &input.Activated, &input.ServiceAccount, &input.Deactivated, &input.TwoFactorEnabled, &input.Version)
 
 	if err != nil {
 
@@ -90,26 +122,326 @@ func (m *UserModel) GetByEmail(email string) (*User, error) {
 	return &input, nil
 }
 
+func (m *UserModel) Get(id int64) (*User, error) {
+
+	var user User
+
+	query := `SELECT id, created_at, name, email, password_hash, activated, service_account, deactivated_at IS NOT NULL, EXISTS (SELECT 1 FROM user_totp WHERE user_totp.user_id = users.id AND user_totp.confirmed_at IS NOT NULL), version FROM users WHERE id = $1 AND deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.CreatedAt, &user.Name, &user.Email, &user.Password.hash, &user.Activated, &user.ServiceAccount, &user.Deactivated, &user.TwoFactorEnabled, &user.Version)
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+
+}
+
 func (m *UserModel) Update(user *User) error {
 
-	query := `UPDATE users SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1 
-	WHERE id = $5 AND version = $6 RETURNING version`
+	query := `UPDATE users SET name = $1, email = $2, password_hash = $3, activated = $4,
+	activated_at = COALESCE(activated_at, CASE WHEN $4 THEN NOW() END),
+	deactivated_at = CASE WHEN $5 THEN COALESCE(deactivated_at, NOW()) END, version = version + 1
+	WHERE id = $6 AND version = $7 RETURNING version`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, user.Name, user.Email, user.Password.hash, user.Activated, user.ID, user.Version).Scan(&user.Version)
+	err := m.DB.QueryRowContext(ctx, query, user.Name, user.Email, user.Password.hash, user.Activated, user.Deactivated, user.ID, user.Version).Scan(&user.Version)
 
 	if err != nil {
 
-		if strings.Contains(err.Error(), `violates unique constraint "users_email_key"`) {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case strings.Contains(err.Error(), `violates unique constraint "users_email_key"`):
 			return ErrDuplicateEmail
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *UserModel) GetAllServiceAccounts() ([]*User, error) {
+
+	query := `SELECT id, created_at, name, email, activated, service_account, version FROM users WHERE service_account ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	users := []*User{}
+
+	for rows.Next() {
+
+		var user User
+
+		err := rows.Scan(&user.ID, &user.CreatedAt, &user.Name, &user.Email, &user.Activated, &user.ServiceAccount, &user.Version)
+		if err != nil {
+			return nil, err
 		}
 
+		users = append(users, &user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+
+}
+
+// GetAll searches user accounts by name or email address. A nil activated
+// returns both activated and unactivated accounts.
+func (m *UserModel) GetAll(search string, activated *bool, filters Filters) ([]*User, Metadata, error) {
+
+	query := fmt.Sprintf(`SELECT count(*) OVER(), id, created_at, name, email, activated, service_account, deactivated_at IS NOT NULL, EXISTS (SELECT 1 FROM user_totp WHERE user_totp.user_id = users.id AND user_totp.confirmed_at IS NOT NULL), version
+	FROM users
+	WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR email ILIKE '%%' || $1 || '%%' OR $1 = '')
+	AND (activated = $2 OR $2 IS NULL) AND deleted_at IS NULL
+	ORDER BY %s %s, id ASC
+	LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, search, activated, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*User{}
+
+	for rows.Next() {
+
+		var user User
+
+		err := rows.Scan(&totalRecords, &user.ID, &user.CreatedAt, &user.Name, &user.Email, &user.Activated, &user.ServiceAccount, &user.Deactivated, &user.TwoFactorEnabled, &user.Version)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		users = append(users, &user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return users, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+
+}
+
+func (m *UserModel) DeleteServiceAccount(id int64) error {
+
+	query := `DELETE FROM users WHERE id = $1 AND service_account`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+
+}
+
+// SoftDelete marks the account as deleted and signs it out everywhere. The
+// account stays restorable until PurgeDeleted removes it.
+func (m *UserModel) SoftDelete(id int64) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE users SET deleted_at = NOW(), version = version + 1 WHERE id = $1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM oauth_tokens WHERE user_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM oauth_authorization_codes WHERE user_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+
+}
+
+func (m *UserModel) Restore(id int64) error {
+
+	query := `UPDATE users SET deleted_at = NULL, version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
 		return err
 	}
 
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
 	return nil
+
+}
+
+// PurgeDeleted permanently removes accounts that were deleted more than
+// gracePeriod ago, returning how many went.
+func (m *UserModel) PurgeDeleted(gracePeriod time.Duration) (int64, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	// The audit trail and sign-in throttles would otherwise outlive the
+	// account, still holding its email address and IP addresses.
+	query := `
+	DELETE FROM auth_events
+	WHERE user_id IN (SELECT id FROM users WHERE deleted_at < NOW() - $1 * INTERVAL '1 second')
+	OR email IN (SELECT email FROM users WHERE deleted_at < NOW() - $1 * INTERVAL '1 second')`
+
+	_, err = tx.ExecContext(ctx, query, gracePeriod.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	query = `
+	DELETE FROM login_throttles
+	WHERE key IN (SELECT 'email:' || lower(email::text) FROM users WHERE deleted_at < NOW() - $1 * INTERVAL '1 second')`
+
+	_, err = tx.ExecContext(ctx, query, gracePeriod.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM users WHERE deleted_at < NOW() - $1 * INTERVAL '1 second'`, gracePeriod.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, tx.Commit()
+
+}
+
+// RehashPassword hashes the user's password again with the current
+// settings. The new hash isn't stored if the password was changed in the
+// meantime.
+func (m *UserModel) RehashPassword(user *User, plainTextPassword string) error {
+
+	oldHash := user.Password.hash
+
+	err := user.Password.Set(plainTextPassword)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE users SET password_hash = $1 WHERE id = $2 AND password_hash = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, user.Password.hash, user.ID, oldHash)
+	return err
+
+}
+
+// DeleteUnactivated removes accounts that were never activated within
+// maxAge of signing up, freeing their email addresses. Accounts deactivated
+// later on are kept, as is anything holding grants or movies, in case it
+// was activated before activated_at was recorded.
+func (m *UserModel) DeleteUnactivated(maxAge time.Duration) (int64, error) {
+
+	query := `
+	DELETE FROM users
+	WHERE activated_at IS NULL AND deactivated_at IS NULL AND NOT service_account AND created_at < NOW() - $1 * INTERVAL '1 second'
+	AND NOT EXISTS (SELECT 1 FROM users_roles WHERE users_roles.user_id = users.id)
+	AND NOT EXISTS (SELECT 1 FROM users_permissions WHERE users_permissions.user_id = users.id)
+	AND NOT EXISTS (SELECT 1 FROM movies WHERE movies.created_by = users.id)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, maxAge.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+
 }
 
 func ValidateEmail(v *validator.Validator, email string) {
@@ -121,9 +453,17 @@ func ValidateEmail(v *validator.Validator, email string) {
 
 func ValidatePasswordPlaintext(v *validator.Validator, plainTextPassword string) {
 
-	v.Check(plainTextPassword != "", "password", "must be provided")
-	v.Check(len(plainTextPassword) >= 8, "password", "must be at least 8 bytes long")
-	v.Check(len(plainTextPassword) <= 72, "password", "must not be more than 72 bytes long")
+	ValidatePasswordPlaintextField(v, "password", plainTextPassword)
+
+}
+
+// ValidatePasswordPlaintextField is ValidatePasswordPlaintext for requests
+// where the password isn't sent as "password", reporting errors under key.
+func ValidatePasswordPlaintextField(v *validator.Validator, key, plainTextPassword string) {
+
+	v.Check(plainTextPassword != "", key, "must be provided")
+	v.Check(len(plainTextPassword) >= 8, key, "must be at least 8 bytes long")
+	v.Check(len(plainTextPassword) <= PasswordHashing.MaxLength(), key, fmt.Sprintf("must not be more than %d bytes long", PasswordHashing.MaxLength()))
 
 }
 
@@ -143,13 +483,16 @@ func ValidateUser(v *validator.Validator, user *User) {
 }
 
 type User struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Password  password  `json:"-"`
-	Activated bool      `json:"activated"`
-	Version   int       `json:"-"`
+	ID               int64     `json:"id"`
+	CreatedAt        time.Time `json:"created_at"`
+	Name             string    `json:"name"`
+	Email            string    `json:"email"`
+	Password         password  `json:"-"`
+	Activated        bool      `json:"activated"`
+	ServiceAccount   bool      `json:"service_account"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	Deactivated      bool      `json:"deactivated"`
+	Version          int       `json:"-"`
 }
 
 var AnonymousUser = &User{}
@@ -165,9 +508,14 @@ type password struct {
 	hash      []byte
 }
 
+// PasswordHashing decides how new password hashes are made. Existing
+// hashes made with other settings keep working and are upgraded on the next
+// sign-in.
+var PasswordHashing = passhash.DefaultParams
+
 func (p *password) Set(plainTextPassword string) error {
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(plainTextPassword), 12)
+	hash, err := PasswordHashing.Hash(plainTextPassword)
 	if err != nil {
 		return err
 	}
@@ -180,16 +528,29 @@ func (p *password) Set(plainTextPassword string) error {
 
 func (p *password) Matches(plainTextPassword string) (bool, error) {
 
-	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plainTextPassword))
-	if err != nil {
+	return passhash.Verify(plainTextPassword, p.hash)
 
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+}
 
-			return false, nil
-		}
-		return false, err
-	}
+// NeedsRehash reports whether the stored hash was made with an outdated
+// algorithm or parameters.
+func (p *password) NeedsRehash() bool {
+
+	return PasswordHashing.NeedsRehash(p.hash)
+
+}
+
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+
+	hash, _ := PasswordHashing.Hash(rand.Text())
+	return hash
+
+})
+
+// CompareDummyPassword takes as long as checking a real password, so that
+// sign-in attempts for unknown users can't be told apart by timing.
+func CompareDummyPassword(plainTextPassword string) {
 
-	return true, nil
+	passhash.Verify(plainTextPassword, dummyPasswordHash())
 
 }
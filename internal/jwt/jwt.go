@@ -0,0 +1,197 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+	ErrUnknownKey   = errors.New("unknown signing key")
+)
+
+// minKeyLength is the shortest secret accepted for HS256, matching the size
+// of the hash output.
+const minKeyLength = 32
+
+// RegisteredClaims are the standard claims checked by Verify. Embed them in
+// an application specific claims struct.
+type RegisteredClaims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// Keyset holds the HMAC secrets tokens may be signed with, indexed by key
+// ID. New tokens are signed with SigningKeyID; the remaining keys are only
+// used for verification, so a key can be rotated out once every token
+// signed with it has expired.
+type Keyset struct {
+	SigningKeyID string
+	keys         map[string][]byte
+}
+
+// ParseKeyset reads a comma-separated list of kid:secret pairs. The first
+// pair becomes the signing key.
+func ParseKeyset(s string) (*Keyset, error) {
+
+	ks := &Keyset{keys: make(map[string][]byte)}
+
+	for _, pair := range strings.Split(s, ",") {
+
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		kid, secret, ok := strings.Cut(pair, ":")
+		if !ok || kid == "" {
+			return nil, fmt.Errorf("jwt: key %q must be in the form kid:secret", pair)
+		}
+
+		if len(secret) < minKeyLength {
+			return nil, fmt.Errorf("jwt: key %q must be at least %d bytes long", kid, minKeyLength)
+		}
+
+		if _, exists := ks.keys[kid]; exists {
+			return nil, fmt.Errorf("jwt: duplicate key id %q", kid)
+		}
+
+		ks.keys[kid] = []byte(secret)
+
+		if ks.SigningKeyID == "" {
+			ks.SigningKeyID = kid
+		}
+	}
+
+	if ks.SigningKeyID == "" {
+		return nil, errors.New("jwt: no signing keys configured")
+	}
+
+	return ks, nil
+
+}
+
+// Sign encodes claims as an HS256 JWT using the signing key.
+func (ks *Keyset) Sign(claims any) (string, error) {
+
+	h, err := json.Marshal(header{Algorithm: "HS256", Type: "JWT", KeyID: ks.SigningKeyID})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := encode(h) + "." + encode(payload)
+
+	return unsigned + "." + encode(sign(ks.keys[ks.SigningKeyID], unsigned)), nil
+
+}
+
+// Verify checks the token's signature and registered claims, then decodes
+// its payload into claims.
+func (ks *Keyset) Verify(token string, claims any) error {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrInvalidToken
+	}
+
+	var h header
+
+	err := decode(parts[0], &h)
+	if err != nil || h.Algorithm != "HS256" {
+		return ErrInvalidToken
+	}
+
+	key, ok := ks.keys[h.KeyID]
+	if !ok {
+		return ErrUnknownKey
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	if !hmac.Equal(signature, sign(key, parts[0]+"."+parts[1])) {
+		return ErrInvalidToken
+	}
+
+	var registered RegisteredClaims
+
+	err = decode(parts[1], &registered)
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	now := time.Now().Unix()
+
+	if registered.ExpiresAt == 0 || now >= registered.ExpiresAt {
+		return ErrExpiredToken
+	}
+
+	if registered.NotBefore != 0 && now < registered.NotBefore {
+		return ErrInvalidToken
+	}
+
+	err = decode(parts[1], claims)
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	return nil
+
+}
+
+// LooksLikeToken reports whether s has the three dot-separated segments of
+// a JWT, so callers can tell it apart from other bearer tokens.
+func LooksLikeToken(s string) bool {
+
+	return strings.Count(s, ".") == 2
+
+}
+
+func sign(key []byte, data string) []byte {
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+
+}
+
+func encode(b []byte) string {
+
+	return base64.RawURLEncoding.EncodeToString(b)
+
+}
+
+func decode(s string, dst any) error {
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, dst)
+
+}
@@ -0,0 +1,311 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	oldSecret = "old-secret-0123456789abcdef012345"
+	newSecret = "new-secret-0123456789abcdef012345"
+)
+
+type testClaims struct {
+	RegisteredClaims
+	Name string `json:"name"`
+}
+
+// craft builds a token from raw header and payload JSON, signed with key.
+func craft(header, payload string, key []byte) string {
+
+	unsigned := encode([]byte(header)) + "." + encode([]byte(payload))
+	return unsigned + "." + encode(sign(key, unsigned))
+
+}
+
+// craftRaw is like craft, but takes the payload segment already encoded.
+func craftRaw(header, payloadSegment string, key []byte) string {
+
+	unsigned := encode([]byte(header)) + "." + payloadSegment
+	return unsigned + "." + encode(sign(key, unsigned))
+
+}
+
+func TestParseKeyset(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		input      string
+		wantSigner string
+		wantErr    bool
+	}{
+		{"single key", "a:" + oldSecret, "a", false},
+		{"first key signs", " b:" + newSecret + " , a:" + oldSecret, "b", false},
+		{"exactly minimum length", "a:" + strings.Repeat("x", minKeyLength), "a", false},
+		{"secret may contain colons", "a:" + strings.Repeat(":", minKeyLength), "a", false},
+		{"one byte short", "a:" + strings.Repeat("x", minKeyLength-1), "", true},
+		{"empty", "", "", true},
+		{"only commas", " , ,", "", true},
+		{"missing secret", "a", "", true},
+		{"missing kid", ":" + oldSecret, "", true},
+		{"duplicate kid", "a:" + oldSecret + ",a:" + newSecret, "", true},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			ks, err := ParseKeyset(tt.input)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseKeyset(%q): want error", tt.input)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseKeyset(%q): %v", tt.input, err)
+			}
+
+			if ks.SigningKeyID != tt.wantSigner {
+				t.Errorf("SigningKeyID = %q, want %q", ks.SigningKeyID, tt.wantSigner)
+			}
+		})
+	}
+
+}
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+
+	ks, err := ParseKeyset("a:" + oldSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := testClaims{RegisteredClaims{Subject: "42", ExpiresAt: time.Now().Add(time.Minute).Unix()}, "alice"}
+
+	token, err := ks.Sign(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !LooksLikeToken(token) {
+		t.Errorf("LooksLikeToken(%q) = false", token)
+	}
+
+	var got testClaims
+
+	err = ks.Verify(token, &got)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	if got != want {
+		t.Errorf("Verify decoded %+v, want %+v", got, want)
+	}
+
+}
+
+func TestVerifyRejects(t *testing.T) {
+
+	ks, err := ParseKeyset("a:" + oldSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := []byte(oldSecret)
+	exp := time.Now().Add(time.Minute).Unix()
+	payload := `{"sub":"42","exp":` + strconv.FormatInt(exp, 10) + `}`
+	admin := `{"sub":"1","exp":` + strconv.FormatInt(exp, 10) + `}`
+	hs256 := `{"alg":"HS256","typ":"JWT","kid":"a"}`
+
+	valid := craft(hs256, payload, key)
+	parts := strings.Split(valid, ".")
+
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	signature[0] ^= 1
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"tampered payload", parts[0] + "." + encode([]byte(admin)) + "." + parts[2], ErrInvalidToken},
+		{"tampered signature", parts[0] + "." + parts[1] + "." + encode(signature), ErrInvalidToken},
+		{"truncated signature", parts[0] + "." + parts[1] + "." + parts[2][:10], ErrInvalidToken},
+		{"empty signature", parts[0] + "." + parts[1] + ".", ErrInvalidToken},
+		{"signed with another key", craft(hs256, payload, []byte(newSecret)), ErrInvalidToken},
+		{"alg none", encode([]byte(`{"alg":"none","kid":"a"}`)) + "." + parts[1] + ".", ErrInvalidToken},
+		{"alg none with signature", craft(`{"alg":"none","kid":"a"}`, payload, key), ErrInvalidToken},
+		{"alg lowercase", craft(`{"alg":"hs256","kid":"a"}`, payload, key), ErrInvalidToken},
+		{"alg HS512", craft(`{"alg":"HS512","kid":"a"}`, payload, key), ErrInvalidToken},
+		{"alg RS256", craft(`{"alg":"RS256","kid":"a"}`, payload, key), ErrInvalidToken},
+		{"alg missing", craft(`{"kid":"a"}`, payload, key), ErrInvalidToken},
+		{"unknown kid", craft(`{"alg":"HS256","kid":"b"}`, payload, key), ErrUnknownKey},
+		{"missing kid", craft(`{"alg":"HS256"}`, payload, key), ErrUnknownKey},
+		{"one segment", parts[0], ErrInvalidToken},
+		{"two segments", parts[0] + "." + parts[1], ErrInvalidToken},
+		{"four segments", valid + "." + parts[2], ErrInvalidToken},
+		{"empty", "", ErrInvalidToken},
+		{"header not base64", "!!!." + parts[1] + "." + parts[2], ErrInvalidToken},
+		{"header padded base64", base64.URLEncoding.EncodeToString([]byte(hs256+" ")) + "." + parts[1] + "." + parts[2], ErrInvalidToken},
+		{"header not JSON", encode([]byte("HS256")) + "." + parts[1] + "." + parts[2], ErrInvalidToken},
+		{"signature not base64", parts[0] + "." + parts[1] + ".!!!", ErrInvalidToken},
+		{"payload not base64", craftRaw(hs256, "!!!", key), ErrInvalidToken},
+		{"payload not JSON", craft(hs256, "not json", key), ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			var claims testClaims
+
+			err := ks.Verify(tt.token, &claims)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestVerifyTimeClaims(t *testing.T) {
+
+	ks, err := ParseKeyset("a:" + oldSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Unix()
+
+	// Verify reads the clock after the token is signed, so only boundaries
+	// that hold as time moves forward are checked exactly.
+	tests := []struct {
+		name   string
+		claims RegisteredClaims
+		want   error
+	}{
+		{"expires in a minute", RegisteredClaims{ExpiresAt: now + 60}, nil},
+		{"expires now", RegisteredClaims{ExpiresAt: now}, ErrExpiredToken},
+		{"expired a second ago", RegisteredClaims{ExpiresAt: now - 1}, ErrExpiredToken},
+		{"no expiry", RegisteredClaims{}, ErrExpiredToken},
+		{"valid from now", RegisteredClaims{NotBefore: now, ExpiresAt: now + 60}, nil},
+		{"valid from a second ago", RegisteredClaims{NotBefore: now - 1, ExpiresAt: now + 60}, nil},
+		{"not valid for a minute", RegisteredClaims{NotBefore: now + 60, ExpiresAt: now + 120}, ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			token, err := ks.Sign(tt.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var claims RegisteredClaims
+
+			err = ks.Verify(token, &claims)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+}
+
+// TestKeyRotation checks that adding a new signing key in front of the old
+// one keeps tokens signed with the old key valid, and that removing the old
+// key afterwards invalidates them.
+func TestKeyRotation(t *testing.T) {
+
+	before, err := ParseKeyset("old:" + oldSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	during, err := ParseKeyset("new:" + newSecret + ",old:" + oldSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := ParseKeyset("new:" + newSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := RegisteredClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()}
+
+	oldToken, err := before.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newToken, err := during.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var h header
+
+	err = decode(strings.Split(newToken, ".")[0], &h)
+	if err != nil || h.KeyID != "new" {
+		t.Errorf("token signed during rotation has kid %q, %v; want %q", h.KeyID, err, "new")
+	}
+
+	tests := []struct {
+		name  string
+		ks    *Keyset
+		token string
+		want  error
+	}{
+		{"old token during rotation", during, oldToken, nil},
+		{"new token during rotation", during, newToken, nil},
+		{"new token after rotation", after, newToken, nil},
+		{"old token after rotation", after, oldToken, ErrUnknownKey},
+		{"new token before rotation", before, newToken, ErrUnknownKey},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			var got RegisteredClaims
+
+			err := tt.ks.Verify(tt.token, &got)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestLooksLikeToken(t *testing.T) {
+
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"a.b.c", true},
+		{"..", true},
+		{"Y3UOPSNK3RFQWWOHHSGAQUSBOY", false},
+		{"a.b", false},
+		{"a.b.c.d", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+
+		if got := LooksLikeToken(tt.s); got != tt.want {
+			t.Errorf("LooksLikeToken(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+
+}
@@ -0,0 +1,206 @@
+// Package passhash hashes passwords with argon2id or bcrypt. Hashes are
+// self-describing: argon2id ones use the PHC string format and bcrypt ones
+// the usual modular crypt format, so either can be verified whatever the
+// current settings are.
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+// BcryptMaxLength is the most bcrypt looks at; anything after it is ignored.
+const BcryptMaxLength = 72
+
+var ErrInvalidHash = errors.New("passhash: invalid hash")
+
+var encoding = base64.RawStdEncoding
+
+type Params struct {
+	Algorithm string
+
+	BcryptCost int
+
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultParams follow the OWASP recommendations for argon2id.
+var DefaultParams = Params{
+	Algorithm:   Argon2id,
+	BcryptCost:  12,
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func (p Params) Validate() error {
+
+	switch p.Algorithm {
+	case Argon2id:
+		if p.Memory < 8*uint32(p.Parallelism) || p.Iterations < 1 || p.Parallelism < 1 {
+			return errors.New("passhash: argon2id needs at least 1 iteration, 1 thread and 8 KiB of memory per thread")
+		}
+		if p.SaltLength < 8 || p.KeyLength < 16 {
+			return errors.New("passhash: argon2id salt must be at least 8 bytes and key at least 16 bytes")
+		}
+	case Bcrypt:
+		if p.BcryptCost < bcrypt.MinCost || p.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("passhash: bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return fmt.Errorf("passhash: unknown algorithm %q", p.Algorithm)
+	}
+
+	return nil
+
+}
+
+// MaxLength returns the longest password the algorithm fully uses.
+func (p Params) MaxLength() int {
+
+	if p.Algorithm == Bcrypt {
+		return BcryptMaxLength
+	}
+
+	return 1024
+
+}
+
+func (p Params) Hash(plainText string) ([]byte, error) {
+
+	if p.Algorithm == Bcrypt {
+		return bcrypt.GenerateFromPassword([]byte(plainText), p.BcryptCost)
+	}
+
+	salt := make([]byte, p.SaltLength)
+	rand.Read(salt)
+
+	key := argon2.IDKey([]byte(plainText), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	hash := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations, p.Parallelism, encoding.EncodeToString(salt), encoding.EncodeToString(key))
+
+	return []byte(hash), nil
+
+}
+
+// NeedsRehash reports whether hash was made with a different algorithm or
+// different parameters than p.
+func (p Params) NeedsRehash(hash []byte) bool {
+
+	if isBcrypt(hash) {
+
+		if p.Algorithm != Bcrypt {
+			return true
+		}
+
+		cost, err := bcrypt.Cost(hash)
+		return err != nil || cost != p.BcryptCost
+	}
+
+	if p.Algorithm != Argon2id {
+		return true
+	}
+
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return params.Memory != p.Memory || params.Iterations != p.Iterations || params.Parallelism != p.Parallelism ||
+		uint32(len(salt)) != p.SaltLength || uint32(len(key)) != p.KeyLength
+
+}
+
+// Verify checks plainText against a hash made by any supported algorithm.
+func Verify(plainText string, hash []byte) (bool, error) {
+
+	if isBcrypt(hash) {
+
+		// Newer versions of bcrypt refuse long passwords outright rather
+		// than truncating them; such a password can't have been set.
+		if len(plainText) > BcryptMaxLength {
+			return false, nil
+		}
+
+		err := bcrypt.CompareHashAndPassword(hash, []byte(plainText))
+		if err != nil {
+
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, nil
+			}
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+
+	other := argon2.IDKey([]byte(plainText), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+
+}
+
+func isBcrypt(hash []byte) bool {
+
+	return len(hash) > 4 && hash[0] == '$' && hash[1] == '2'
+
+}
+
+func decodeArgon2id(hash []byte) (Params, []byte, []byte, error) {
+
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != Argon2id {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	p := Params{Algorithm: Argon2id}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism)
+	if err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := encoding.DecodeString(parts[4])
+	if err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	key, err := encoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	return p, salt, key, nil
+
+}
@@ -0,0 +1,205 @@
+package passhash
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap settings keep the tests fast; the format is the same at any cost.
+var (
+	testArgon2id = Params{Algorithm: Argon2id, Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	testBcrypt   = Params{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost}
+)
+
+func TestRoundTrip(t *testing.T) {
+
+	for _, p := range []Params{testArgon2id, testBcrypt} {
+
+		t.Run(p.Algorithm, func(t *testing.T) {
+
+			hash, err := p.Hash("pa55word-of-some-length")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ok, err := Verify("pa55word-of-some-length", hash)
+			if err != nil || !ok {
+				t.Errorf("Verify(correct) = %v, %v; want true", ok, err)
+			}
+
+			ok, err = Verify("pa55word-of-some-lengtH", hash)
+			if err != nil || ok {
+				t.Errorf("Verify(wrong) = %v, %v; want false", ok, err)
+			}
+
+			if p.NeedsRehash(hash) {
+				t.Error("NeedsRehash is true for a hash made with the same params")
+			}
+		})
+	}
+
+}
+
+func TestHashFormat(t *testing.T) {
+
+	hash, err := testArgon2id.Hash("pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(hash), "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("hash %q is not in PHC format", hash)
+	}
+
+	other, _ := testArgon2id.Hash("pa55word")
+
+	if string(hash) == string(other) {
+		t.Error("two hashes of the same password are identical; salt isn't random")
+	}
+
+}
+
+func TestVerifyBcryptTooLong(t *testing.T) {
+
+	long := strings.Repeat("a", BcryptMaxLength+1)
+
+	hash, err := testBcrypt.Hash(long[:BcryptMaxLength])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := Verify(long, hash)
+	if err != nil || ok {
+		t.Errorf("Verify(too long) = %v, %v; want false, nil", ok, err)
+	}
+
+}
+
+func TestNeedsRehash(t *testing.T) {
+
+	argonHash, err := testArgon2id.Hash("pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bcryptHash, err := testBcrypt.Hash("pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	with := func(change func(*Params)) Params {
+		p := testArgon2id
+		change(&p)
+		return p
+	}
+
+	tests := []struct {
+		name   string
+		params Params
+		hash   []byte
+		want   bool
+	}{
+		{"same argon2id params", testArgon2id, argonHash, false},
+		{"more memory", with(func(p *Params) { p.Memory = 128 }), argonHash, true},
+		{"more iterations", with(func(p *Params) { p.Iterations = 2 }), argonHash, true},
+		{"more threads", with(func(p *Params) { p.Parallelism = 2 }), argonHash, true},
+		{"longer salt", with(func(p *Params) { p.SaltLength = 32 }), argonHash, true},
+		{"longer key", with(func(p *Params) { p.KeyLength = 64 }), argonHash, true},
+		{"argon2id to bcrypt", testBcrypt, argonHash, true},
+		{"bcrypt to argon2id", testArgon2id, bcryptHash, true},
+		{"same bcrypt cost", testBcrypt, bcryptHash, false},
+		{"higher bcrypt cost", Params{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost + 1}, bcryptHash, true},
+		{"malformed hash", testArgon2id, []byte("$argon2id$garbage"), true},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			if got := tt.params.NeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("NeedsRehash = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestVerifyMalformed(t *testing.T) {
+
+	valid, err := testArgon2id.Hash("pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(string(valid), "$")
+
+	replace := func(i int, value string) []byte {
+		p := append([]string(nil), parts...)
+		p[i] = value
+		return []byte(strings.Join(p, "$"))
+	}
+
+	tests := []struct {
+		name string
+		hash []byte
+	}{
+		{"empty", nil},
+		{"not a hash", []byte("pa55word")},
+		{"too few fields", []byte(strings.Join(parts[:5], "$"))},
+		{"too many fields", []byte(string(valid) + "$extra")},
+		{"other algorithm", replace(1, "argon2i")},
+		{"unsupported version", replace(2, "v=16")},
+		{"bad version", replace(2, "version")},
+		{"bad params", replace(3, "m=64;t=1;p=1")},
+		{"bad salt", replace(4, "!!!")},
+		{"bad key", replace(5, "!!!")},
+		{"empty key", replace(5, "")},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			ok, err := Verify("pa55word", tt.hash)
+			if ok || !errors.Is(err, ErrInvalidHash) {
+				t.Errorf("Verify = %v, %v; want false, ErrInvalidHash", ok, err)
+			}
+		})
+	}
+
+}
+
+func TestValidate(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		params  Params
+		wantErr bool
+	}{
+		{"defaults", DefaultParams, false},
+		{"test argon2id", testArgon2id, false},
+		{"test bcrypt", testBcrypt, false},
+		{"unknown algorithm", Params{Algorithm: "md5"}, true},
+		{"no iterations", Params{Algorithm: Argon2id, Memory: 64, Parallelism: 1, SaltLength: 16, KeyLength: 32}, true},
+		{"too little memory", Params{Algorithm: Argon2id, Memory: 8, Iterations: 1, Parallelism: 2, SaltLength: 16, KeyLength: 32}, true},
+		{"short salt", Params{Algorithm: Argon2id, Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 4, KeyLength: 32}, true},
+		{"short key", Params{Algorithm: Argon2id, Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 8}, true},
+		{"bcrypt cost too low", Params{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost - 1}, true},
+		{"bcrypt cost too high", Params{Algorithm: Bcrypt, BcryptCost: bcrypt.MaxCost + 1}, true},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			err := tt.params.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+
+}
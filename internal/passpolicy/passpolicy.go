@@ -0,0 +1,280 @@
+// Package passpolicy decides whether a new password is strong enough: it
+// estimates how hard the password is to guess, rejects common and breached
+// passwords, and rejects passwords built from the user's own details.
+package passpolicy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+//go:embed common_passwords.txt
+var defaultBlocklist []byte
+
+// Violation messages, phrased to follow the field name in validation errors.
+const (
+	TooWeak       = "is too easy to guess, try a longer passphrase or mixing in other characters"
+	TooCommon     = "is too common, please choose a different one"
+	PersonalInfo  = "must not contain your name or email address"
+	KnownBreached = "has appeared in a data breach and must not be used"
+)
+
+const MaxScore = 4
+
+// breachPrefixLength is how many hex digits of the SHA-1 hash name a range file.
+const breachPrefixLength = 5
+
+type Policy struct {
+	// MinScore is the lowest acceptable Score, from 0 to MaxScore.
+	MinScore int
+
+	blocklist map[string]struct{}
+
+	// breachDir holds a k-anonymity dataset: one file per 5-character
+	// uppercase SHA-1 prefix, each line a hash suffix and a count separated
+	// by a colon, as served by the Pwned Passwords range API.
+	breachDir string
+}
+
+// New loads the blocklist from blocklistPath, or the built-in list if it is
+// empty. The breached password check is skipped if breachDir is empty.
+func New(minScore int, blocklistPath, breachDir string) (*Policy, error) {
+
+	if minScore < 0 || minScore > MaxScore {
+		return nil, fmt.Errorf("passpolicy: minimum score must be between 0 and %d", MaxScore)
+	}
+
+	list := defaultBlocklist
+
+	if blocklistPath != "" {
+
+		b, err := os.ReadFile(blocklistPath)
+		if err != nil {
+			return nil, err
+		}
+		list = b
+	}
+
+	if breachDir != "" {
+
+		info, err := os.Stat(breachDir)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			return nil, fmt.Errorf("passpolicy: %s is not a directory", breachDir)
+		}
+	}
+
+	p := &Policy{MinScore: minScore, blocklist: make(map[string]struct{}), breachDir: breachDir}
+
+	scanner := bufio.NewScanner(bytes.NewReader(list))
+
+	for scanner.Scan() {
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p.blocklist[strings.ToLower(line)] = struct{}{}
+	}
+
+	return p, scanner.Err()
+
+}
+
+// Check returns the first rule the password breaks, or an empty string if
+// it is acceptable. An error is only returned if the breach dataset can't
+// be read.
+func (p *Policy) Check(password, name, email string) (string, error) {
+
+	if containsPersonalInfo(password, name, email) {
+		return PersonalInfo, nil
+	}
+
+	if p.isCommon(password) {
+		return TooCommon, nil
+	}
+
+	if Score(password) < p.MinScore {
+		return TooWeak, nil
+	}
+
+	breached, err := p.isBreached(password)
+	if err != nil {
+		return "", err
+	}
+
+	if breached {
+		return KnownBreached, nil
+	}
+
+	return "", nil
+
+}
+
+// isCommon also catches blocklisted words dressed up with digits and symbols
+// at either end, such as "Password123!".
+func (p *Policy) isCommon(password string) bool {
+
+	lower := strings.ToLower(password)
+
+	if _, ok := p.blocklist[lower]; ok {
+		return true
+	}
+
+	core := strings.TrimFunc(lower, func(r rune) bool { return !unicode.IsLetter(r) })
+	_, ok := p.blocklist[core]
+
+	return ok
+
+}
+
+func (p *Policy) isBreached(password string) (bool, error) {
+
+	if p.breachDir == "" {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	f, err := os.Open(filepath.Join(p.breachDir, hash[:breachPrefixLength]))
+	if err != nil {
+
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	defer f.Close()
+
+	return containsSuffix(f, hash[breachPrefixLength:])
+
+}
+
+func containsSuffix(r io.Reader, suffix string) (bool, error) {
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+
+		line, _, _ := strings.Cut(scanner.Text(), ":")
+
+		if strings.EqualFold(strings.TrimSpace(line), suffix) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+
+}
+
+// containsPersonalInfo looks for the user's email address, its local part
+// or any word of their name of three or more characters.
+func containsPersonalInfo(password, name, email string) bool {
+
+	lower := strings.ToLower(password)
+
+	parts := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+
+	if local, _, ok := strings.Cut(strings.ToLower(email), "@"); ok {
+		parts = append(parts, strings.ToLower(email), local)
+	}
+
+	for _, part := range parts {
+		if len(part) >= 3 && strings.Contains(lower, part) {
+			return true
+		}
+	}
+
+	return false
+
+}
+
+// Score rates the password from 0 (trivial) to MaxScore (very strong) by
+// estimating its entropy. Characters that repeat or continue a sequence
+// ("aaaa", "abcd", "4321") add almost nothing, since guessers try those
+// patterns first.
+func Score(password string) int {
+
+	runes := []rune(password)
+
+	var lower, upper, digit, symbol, other bool
+
+	for _, r := range runes {
+
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+
+	for _, c := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if c.used {
+			pool += c.size
+		}
+	}
+
+	if pool == 0 {
+		return 0
+	}
+
+	perChar := math.Log2(float64(pool))
+	bits := 0.0
+
+	for i, r := range runes {
+
+		if i > 0 {
+			step := r - runes[i-1]
+
+			if step == 0 || step == 1 || step == -1 {
+				bits += 1
+				continue
+			}
+		}
+
+		bits += perChar
+	}
+
+	switch {
+	case bits < 28:
+		return 0
+	case bits < 36:
+		return 1
+	case bits < 50:
+		return 2
+	case bits < 64:
+		return 3
+	default:
+		return 4
+	}
+
+}
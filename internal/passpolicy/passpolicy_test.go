@@ -0,0 +1,207 @@
+package passpolicy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+
+	// Lowercase letters that never repeat or step by one are worth about
+	// 4.7 bits each, which puts the thresholds between these lengths.
+	const letters = "qzmxkwpvjrhtfb"
+
+	tests := []struct {
+		password string
+		want     int
+	}{
+		{"", 0},
+		{letters[:5], 0},
+		{letters[:6], 1},
+		{letters[:7], 1},
+		{letters[:8], 2},
+		{letters[:10], 2},
+		{letters[:11], 3},
+		{letters[:13], 3},
+		{letters[:14], 4},
+		{strings.Repeat("a", 20), 0},
+		{"abcdefghijklmnop", 0},
+		{"9876543210", 0},
+		{"correct horse battery staple", 4},
+		{"Xk9#mQ2!", 3},
+	}
+
+	for _, tt := range tests {
+
+		if got := Score(tt.password); got != tt.want {
+			t.Errorf("Score(%q) = %d, want %d", tt.password, got, tt.want)
+		}
+	}
+
+}
+
+func TestIsCommon(t *testing.T) {
+
+	p, err := New(0, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"password", true},
+		{"PASSWORD", true},
+		{"Password123!", true},
+		{"!!password", true},
+		{"2024Dragon#", true},
+		{"123456", true},
+		{"pass word", false},
+		{"passwordy", false},
+		{"my password", false},
+		{"qzmxkwpvjrhtfb", false},
+	}
+
+	for _, tt := range tests {
+
+		if got := p.isCommon(tt.password); got != tt.want {
+			t.Errorf("isCommon(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+
+}
+
+func TestBlocklistFile(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+
+	err := os.WriteFile(path, []byte("# comment\n\n  Hunter2  \nqzmxkwpvjrhtfb\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := New(0, path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for password, want := range map[string]bool{"hunter2": true, "QZMXKWPVJRHTFB99": true, "# comment": false, "password": false} {
+
+		if got := p.isCommon(password); got != want {
+			t.Errorf("isCommon(%q) with custom list = %v, want %v", password, got, want)
+		}
+	}
+
+}
+
+func TestContainsPersonalInfo(t *testing.T) {
+
+	tests := []struct {
+		password, name, email string
+		want                  bool
+	}{
+		{"alice-rocks-2024", "Alice Smith", "asmith@example.com", true},
+		{"xxSMITHxx", "Alice Smith", "asmith@example.com", true},
+		{"asmith!!", "Alice Smith", "asmith@example.com", true},
+		{"asmith@example.com", "Alice Smith", "asmith@example.com", true},
+		{"Mary-Jane1", "mary-jane o'neil", "mj@example.com", true},
+		{"xx-neil-xx", "mary-jane o'neil", "mj@example.com", true},
+		{"mj12345678", "Mary Jane", "mj@example.com", false},
+		{"al-is-short", "Al Bo", "al@example.com", false},
+		{"qzmxkwpvjrhtfb", "Alice Smith", "asmith@example.com", false},
+		{"anything", "", "", false},
+		{"anything", "", "not-an-email", false},
+	}
+
+	for _, tt := range tests {
+
+		if got := containsPersonalInfo(tt.password, tt.name, tt.email); got != tt.want {
+			t.Errorf("containsPersonalInfo(%q, %q, %q) = %v, want %v", tt.password, tt.name, tt.email, got, tt.want)
+		}
+	}
+
+}
+
+func TestCheck(t *testing.T) {
+
+	dir := t.TempDir()
+
+	breached := "Xk9#mQ2!vLp7zR"
+	sum := sha1.Sum([]byte(breached))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	rangeFile := "0018A45C4D1DEF81644B54AB7F969B88D65:3\r\n" + strings.ToLower(hash[breachPrefixLength:]) + ":42\r\n"
+
+	err := os.WriteFile(filepath.Join(dir, hash[:breachPrefixLength]), []byte(rangeFile), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := New(2, "", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		password string
+		want     string
+	}{
+		{"correct horse battery staple", ""},
+		{"smith-correct-horse", PersonalInfo},
+		{"Password123!", TooCommon},
+		{"qzmxkwp", TooWeak},
+		{breached, KnownBreached},
+	}
+
+	for _, tt := range tests {
+
+		got, err := p.Check(tt.password, "Alice Smith", "asmith@example.com")
+		if err != nil {
+			t.Fatalf("Check(%q): %v", tt.password, err)
+		}
+
+		if got != tt.want {
+			t.Errorf("Check(%q) = %q, want %q", tt.password, got, tt.want)
+		}
+	}
+
+}
+
+func TestNew(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "file")
+
+	err := os.WriteFile(file, nil, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                 string
+		minScore             int
+		blocklist, breachDir string
+	}{
+		{"negative score", -1, "", ""},
+		{"score too high", MaxScore + 1, "", ""},
+		{"missing blocklist", 2, filepath.Join(t.TempDir(), "missing"), ""},
+		{"missing breach dir", 2, "", filepath.Join(t.TempDir(), "missing")},
+		{"breach dir is a file", 2, "", file},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			_, err := New(tt.minScore, tt.blocklist, tt.breachDir)
+			if err == nil {
+				t.Error("New: want error")
+			}
+		})
+	}
+
+}
@@ -0,0 +1,155 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed from RFC 6238 Appendix B, "12345678901234567890",
+// in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238(t *testing.T) {
+
+	// The RFC lists 8-digit codes; ours are the last 6 digits of each.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+
+		got, err := Code(rfcSecret, Counter(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", tt.unix, err)
+		}
+
+		if got != tt.want {
+			t.Errorf("Code at %d = %q, want %q", tt.unix, got, tt.want)
+		}
+	}
+
+}
+
+func TestCodeLowercaseSecret(t *testing.T) {
+
+	upper, _ := Code(rfcSecret, 1)
+	lower, err := Code("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", 1)
+
+	if err != nil || lower != upper {
+		t.Errorf("Code with lowercase secret = %q, %v; want %q", lower, err, upper)
+	}
+
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+
+	_, err := Code("not base32!", 1)
+	if err == nil {
+		t.Error("Code with invalid secret: want error")
+	}
+
+}
+
+func TestValidate(t *testing.T) {
+
+	now := time.Unix(1111111111, 0)
+	step := Counter(now)
+
+	codeAt := func(counter int64) string {
+		code, err := Code(rfcSecret, counter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		skew     int
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", codeAt(step), 0, step, true},
+		{"previous step within skew", codeAt(step - 1), 1, step - 1, true},
+		{"next step within skew", codeAt(step + 1), 1, step + 1, true},
+		{"previous step without skew", codeAt(step - 1), 0, 0, false},
+		{"outside skew", codeAt(step - 2), 1, 0, false},
+		{"wrong code", "000000", 1, 0, false},
+		{"too short", codeAt(step)[:5], 1, 0, false},
+		{"too long", codeAt(step) + "0", 1, 0, false},
+		{"empty", "", 1, 0, false},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			gotStep, gotOK := Validate(rfcSecret, tt.code, now, tt.skew)
+
+			if gotOK != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("Validate = (%d, %v), want (%d, %v)", gotStep, gotOK, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+
+}
+
+// TestValidateReplay checks the steps Validate reports, which callers
+// require to increase so a code can't be used twice: a code replayed while
+// still within the skew reports the step it was first accepted at, while
+// the next code reports a later one.
+func TestValidateReplay(t *testing.T) {
+
+	now := time.Unix(2000000000, 0)
+	later := now.Add(Period)
+
+	code, err := Code(rfcSecret, Counter(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accepted, ok := Validate(rfcSecret, code, now, 1)
+	if !ok {
+		t.Fatal("Validate rejected a current code")
+	}
+
+	replayed, ok := Validate(rfcSecret, code, later, 1)
+	if !ok || replayed > accepted {
+		t.Errorf("replayed code matched step %d (ok=%v), want no later than %d", replayed, ok, accepted)
+	}
+
+	next, err := Code(rfcSecret, Counter(later))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := Validate(rfcSecret, next, later, 1)
+	if !ok || step <= accepted {
+		t.Errorf("next code matched step %d (ok=%v), want later than %d", step, ok, accepted)
+	}
+
+}
+
+func TestGenerateSecret(t *testing.T) {
+
+	a, b := GenerateSecret(), GenerateSecret()
+
+	if a == b {
+		t.Error("GenerateSecret returned the same secret twice")
+	}
+
+	key, err := encoding.DecodeString(a)
+	if err != nil || len(key) != 20 {
+		t.Errorf("GenerateSecret = %q decodes to %d bytes, %v; want 20 bytes", a, len(key), err)
+	}
+
+}
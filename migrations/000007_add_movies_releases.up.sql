@@ -0,0 +1,2 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS releases jsonb NOT NULL DEFAULT '[]';
+CREATE INDEX IF NOT EXISTS movies_releases_idx ON movies USING GIN (releases);
@@ -0,0 +1,5 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'released';
+ALTER TABLE movies ADD CONSTRAINT movies_status_check CHECK (status IN ('announced', 'in_production', 'post_production', 'released', 'cancelled'));
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_year_check;
+ALTER TABLE movies ADD CONSTRAINT movies_year_check CHECK (year >= 1888 AND (status <> 'released' OR year <= CAST(date_part('year', now()) AS integer)));
+CREATE INDEX IF NOT EXISTS movies_status_idx ON movies (status);
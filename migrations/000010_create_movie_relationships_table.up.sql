@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS movie_relationships (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    related_movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    type text NOT NULL,
+    UNIQUE (movie_id, related_movie_id, type),
+    CONSTRAINT movie_relationships_type_check CHECK (type IN ('sequel_of', 'prequel_of', 'remake_of', 'spinoff_of')),
+    CONSTRAINT movie_relationships_self_check CHECK (movie_id <> related_movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS movie_relationships_related_movie_id_idx ON movie_relationships (related_movie_id);
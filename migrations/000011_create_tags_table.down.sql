@@ -0,0 +1,4 @@
+DELETE FROM permissions WHERE code = 'tags:moderate';
+DROP TABLE IF EXISTS movies_tags_votes;
+DROP TABLE IF EXISTS movies_tags;
+DROP TABLE IF EXISTS tags;
@@ -0,0 +1,5 @@
+DELETE FROM permissions WHERE code = 'oauth-clients:manage';
+
+DROP TABLE IF EXISTS oauth_tokens;
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TABLE IF EXISTS oauth_clients;
@@ -0,0 +1,5 @@
+DELETE FROM permissions WHERE code = 'users:admin';
+
+DROP INDEX IF EXISTS users_name_idx;
+
+DROP INDEX IF EXISTS permissions_code_idx;
@@ -0,0 +1,5 @@
+CREATE UNIQUE INDEX IF NOT EXISTS permissions_code_idx ON permissions (code);
+
+CREATE INDEX IF NOT EXISTS users_name_idx ON users USING GIN (to_tsvector('simple', name));
+
+INSERT INTO permissions (code) VALUES ('users:admin') ON CONFLICT DO NOTHING;
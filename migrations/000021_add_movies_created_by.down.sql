@@ -0,0 +1,15 @@
+DELETE FROM roles WHERE name = 'contributor';
+
+UPDATE oauth_tokens SET scopes = array_remove(array_remove(scopes, 'movies:write:any'), 'movies:write:own');
+
+UPDATE oauth_authorization_codes SET scopes = array_remove(array_remove(scopes, 'movies:write:any'), 'movies:write:own');
+
+UPDATE oauth_clients SET scopes = array_remove(array_remove(scopes, 'movies:write:any'), 'movies:write:own');
+
+UPDATE api_keys SET permissions = array_remove(array_remove(permissions, 'movies:write:any'), 'movies:write:own');
+
+DELETE FROM permissions WHERE code IN ('movies:write:own', 'movies:write:any');
+
+DROP INDEX IF EXISTS movies_created_by_idx;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS created_by;
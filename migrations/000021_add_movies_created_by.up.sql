@@ -0,0 +1,42 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS created_by bigint REFERENCES users ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS movies_created_by_idx ON movies (created_by);
+
+INSERT INTO permissions (code) VALUES ('movies:write:own'), ('movies:write:any') ON CONFLICT DO NOTHING;
+
+-- Everyone who could write movies before keeps being able to edit any of them.
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users_permissions.user_id, any_permission.id
+FROM users_permissions
+INNER JOIN permissions ON permissions.id = users_permissions.permission_id
+CROSS JOIN (SELECT id FROM permissions WHERE code = 'movies:write:any') AS any_permission
+WHERE permissions.code = 'movies:write'
+ON CONFLICT DO NOTHING;
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles_permissions.role_id, any_permission.id
+FROM roles_permissions
+INNER JOIN permissions ON permissions.id = roles_permissions.permission_id
+CROSS JOIN (SELECT id FROM permissions WHERE code = 'movies:write:any') AS any_permission
+WHERE permissions.code = 'movies:write'
+ON CONFLICT DO NOTHING;
+
+UPDATE api_keys SET permissions = array_append(permissions, 'movies:write:any')
+WHERE 'movies:write' = ANY(permissions) AND NOT 'movies:write:any' = ANY(permissions);
+
+UPDATE oauth_clients SET scopes = array_append(scopes, 'movies:write:any')
+WHERE 'movies:write' = ANY(scopes) AND NOT 'movies:write:any' = ANY(scopes);
+
+UPDATE oauth_authorization_codes SET scopes = array_append(scopes, 'movies:write:any')
+WHERE 'movies:write' = ANY(scopes) AND NOT 'movies:write:any' = ANY(scopes);
+
+UPDATE oauth_tokens SET scopes = array_append(scopes, 'movies:write:any')
+WHERE 'movies:write' = ANY(scopes) AND NOT 'movies:write:any' = ANY(scopes);
+
+INSERT INTO roles (name, description) VALUES ('contributor', 'Can add movies and edit the ones they added') ON CONFLICT DO NOTHING;
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles, permissions
+WHERE (roles.name = 'contributor' AND permissions.code IN ('movies:read', 'movies:write:own'))
+OR (roles.name = 'admin' AND permissions.code IN ('movies:write:own', 'movies:write:any'))
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS data_exports;
+
+DROP INDEX IF EXISTS users_deleted_at_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
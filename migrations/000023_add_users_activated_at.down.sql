@@ -0,0 +1,7 @@
+DELETE FROM permissions WHERE code = 'metrics:read';
+
+DROP INDEX IF EXISTS tokens_expiry_idx;
+
+DROP INDEX IF EXISTS users_unactivated_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS activated_at;
@@ -0,0 +1,22 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS activated_at timestamp(0) with time zone;
+
+-- Accounts an admin deactivated are unactivated too, so anything that only
+-- happens to activated accounts counts as a sign they were activated once.
+UPDATE users SET activated_at = created_at
+WHERE activated_at IS NULL AND (
+	activated
+	OR EXISTS (SELECT 1 FROM users_roles WHERE users_roles.user_id = users.id)
+	OR EXISTS (SELECT 1 FROM users_permissions WHERE users_permissions.user_id = users.id)
+	OR EXISTS (SELECT 1 FROM movies WHERE movies.created_by = users.id)
+);
+
+CREATE INDEX IF NOT EXISTS users_unactivated_idx ON users (created_at) WHERE activated_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS tokens_expiry_idx ON tokens (expiry);
+
+INSERT INTO permissions (code) VALUES ('metrics:read') ON CONFLICT DO NOTHING;
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.code = 'metrics:read'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+-- The grants can't be told apart from ones made by hand, so they are kept.
+SELECT 1;
@@ -0,0 +1,14 @@
+-- API keys and OAuth clients are now limited to what their service account
+-- holds, so give each account the permissions its credentials already use.
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT DISTINCT api_keys.user_id, permissions.id
+FROM api_keys
+INNER JOIN permissions ON permissions.code = ANY(api_keys.permissions)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT DISTINCT oauth_clients.service_account_id, permissions.id
+FROM oauth_clients
+INNER JOIN permissions ON permissions.code = ANY(oauth_clients.scopes)
+WHERE oauth_clients.service_account_id IS NOT NULL
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+UPDATE users SET activated = false WHERE deactivated_at IS NOT NULL;
+
+ALTER TABLE users DROP COLUMN IF EXISTS deactivated_at;
@@ -0,0 +1,11 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_at timestamp(0) with time zone;
+
+-- Accounts an admin deactivated used to be marked unactivated, which let
+-- their owners activate them again. Move the ones that were activated at
+-- some point over to the new state.
+UPDATE users SET activated = true, activated_at = COALESCE(activated_at, created_at), deactivated_at = NOW()
+WHERE NOT activated AND NOT service_account AND (
+	activated_at IS NOT NULL
+	OR EXISTS (SELECT 1 FROM users_roles WHERE users_roles.user_id = users.id)
+	OR EXISTS (SELECT 1 FROM users_permissions WHERE users_permissions.user_id = users.id)
+);